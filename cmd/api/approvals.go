@@ -0,0 +1,258 @@
+// Filename: cmd/api/approvals.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// createApprovalStepHandler for the "POST /v1/approval_steps" endpoint
+func (app *application) createApprovalStepHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Category    string `json:"category"`
+		Name        string `json:"name"`
+		Approver_id int64  `json:"approver_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	step := &data.ApprovalStep{
+		Category:    input.Category,
+		Name:        input.Name,
+		Approver_id: input.Approver_id,
+	}
+	v := validator.New()
+	if data.ValidateApprovalStep(v, step); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Users.Get(step.Approver_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("approver_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Approvals.InsertStep(step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateApprovalStep):
+			v.AddError("name", "is already a step for this category")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"approval_step": step}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listApprovalStepsHandler for the "GET /v1/approval_steps" endpoint
+func (app *application) listApprovalStepsHandler(w http.ResponseWriter, r *http.Request) {
+	category := app.readString(r.URL.Query(), "category", "")
+	steps, err := app.models.Approvals.GetSteps(category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"approval_steps": steps}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteApprovalStepHandler for the "DELETE /v1/approval_steps/:id" endpoint
+func (app *application) deleteApprovalStepHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Approvals.DeleteStep(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "approval step successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listColtechApprovalsHandler for the "GET /v1/coltech_items/:id/approvals" endpoint
+func (app *application) listColtechApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	approvals, err := app.models.Approvals.GetAllForColtech(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"approvals": approvals}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readApproval() looks up the approval for the token in the URL. It sends the
+// response itself and returns nil when there is no usable approval.
+func (app *application) readApproval(w http.ResponseWriter, r *http.Request) *data.Approval {
+	tokenPlaintext := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	v := validator.New()
+	if data.ValidateTokenPlainText(v, tokenPlaintext); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	approval, err := app.models.Approvals.GetForToken(tokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired approval token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return approval
+}
+
+// showApprovalHandler for the "GET /v1/approvals/:token" endpoint
+func (app *application) showApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	approval := app.readApproval(w, r)
+	if approval == nil {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"approval": approval}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// decideApprovalHandler for the "PUT /v1/approvals/:token" endpoint
+func (app *application) decideApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	approval := app.readApproval(w, r)
+	if approval == nil {
+		return
+	}
+	var input struct {
+		Decision string `json:"decision"`
+		Comment  string `json:"comment"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	approval.Decision = input.Decision
+	approval.Comment = input.Comment
+
+	v := validator.New()
+	if data.ValidateApprovalDecision(v, approval); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Approvals.Decide(approval)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"approval": approval}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// recategorisedSteps() returns the approval steps a coltech item moved into
+// another category has to go through, and holds it for them. Coltech items
+// that stay in their category, or are being closed or rejected, need none.
+func (app *application) recategorisedSteps(original, coltech *data.Coltech) ([]*data.ApprovalStep, error) {
+	if coltech.Category == original.Category || coltech.Category == "" ||
+		coltech.Status_val == data.StatusClosed || coltech.Status_val == data.StatusRejected {
+		return nil, nil
+	}
+	steps, err := app.models.Approvals.GetSteps(coltech.Category)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) > 0 {
+		coltech.Status_val = data.StatusAwaitingApproval
+	}
+	return steps, nil
+}
+
+// sendApprovalRequests() emails each approver of a coltech item their one use
+// link. The description of a confidential coltech item is left out since the
+// approver may not be named on it. It runs in the background so errors are
+// logged.
+func (app *application) sendApprovalRequests(coltech *data.Coltech, approvals []*data.Approval) {
+	for _, approval := range approvals {
+		props := map[string]string{
+			"coltech_id":  strconv.FormatInt(coltech.ID, 10),
+			"approval_id": strconv.FormatInt(approval.ID, 10),
+		}
+		user, err := app.models.Users.Get(approval.Approver_id)
+		if err != nil {
+			app.logger.PrintError(err, props)
+			continue
+		}
+		description := coltech.Description
+		if coltech.Confidential {
+			description = ""
+		}
+		data := map[string]interface{}{
+			"coltechID":     coltech.ID,
+			"key":           coltech.Key,
+			"summary":       coltech.Summary,
+			"description":   description,
+			"requester":     coltech.Created_by,
+			"step":          approval.Name,
+			"name":          user.Name,
+			"approvalToken": approval.Token,
+			"approvalURL":   fmt.Sprintf("%s/v1/approvals/%s", app.config.publicURL, approval.Token),
+		}
+		err = app.mailer.Send(user.Email, "approval_request.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, props)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Filename: cmd/api/articles.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The number of articles suggested when a coltech item is created
+const suggestedArticles = 5
+
+// createArticleHandler for the "POST /v1/kb_articles" endpoint
+func (app *application) createArticleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title      string `json:"title"`
+		Body       string `json:"body"`
+		Category   string `json:"category"`
+		Status     string `json:"status"`
+		Created_by string `json:"created_by"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	article := &data.Article{
+		Title:      input.Title,
+		Body:       input.Body,
+		Category:   input.Category,
+		Status:     input.Status,
+		Created_by: input.Created_by,
+	}
+	// New articles are drafts unless the author publishes them straight away
+	if article.Status == "" {
+		article.Status = data.ArticleDraft
+	}
+	if article.Created_by == "" {
+		article.Created_by = app.contextGetUser(r).Email
+	}
+	v := validator.New()
+	if data.ValidateArticle(v, article); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Articles.Insert(article)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/kb_articles/%d", article.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"article": article}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showArticleHandler for the "GET /v1/kb_articles/:id" endpoint
+func (app *application) showArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	article, err := app.models.Articles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Drafts are only visible to the people who can edit them
+	if article.Status != data.ArticlePublished {
+		canWrite, err := app.hasPermission(r, "kb:write")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !canWrite {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"article": article}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listArticlesHandler for the "GET /v1/kb_articles" endpoint
+func (app *application) listArticlesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search   string
+		Category string
+		Status   string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Search = app.readString(qs, "search", "")
+	input.Category = app.readString(qs, "category", "")
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = []string{"id", "title", "category", "updated_on", "-id", "-title", "-category", "-updated_on"}
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.ArticleDraft, data.ArticlePublished), "status", "must be draft or published")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	canWrite, err := app.hasPermission(r, "kb:write")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !canWrite {
+		input.Status = data.ArticlePublished
+	}
+	articles, metadata, err := app.models.Articles.GetAll(input.Search, input.Category, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"articles": articles, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateArticleHandler for the "PATCH /v1/kb_articles/:id" endpoint
+func (app *application) updateArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	article, err := app.models.Articles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Title      *string `json:"title"`
+		Body       *string `json:"body"`
+		Category   *string `json:"category"`
+		Status     *string `json:"status"`
+		Created_by *string `json:"created_by"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Title != nil {
+		article.Title = *input.Title
+	}
+	if input.Body != nil {
+		article.Body = *input.Body
+	}
+	if input.Category != nil {
+		article.Category = *input.Category
+	}
+	if input.Status != nil {
+		article.Status = *input.Status
+	}
+	if input.Created_by != nil {
+		article.Created_by = *input.Created_by
+	}
+	v := validator.New()
+	if data.ValidateArticle(v, article); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Articles.Update(article)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"article": article}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteArticleHandler for the "DELETE /v1/kb_articles/:id" endpoint
+func (app *application) deleteArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Articles.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "article successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listColtechArticlesHandler for the "GET /v1/coltech_items/:id/kb_articles" endpoint
+func (app *application) listColtechArticlesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	canWrite, err := app.hasPermission(r, "kb:write")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	articles, err := app.models.Articles.GetAllForColtech(id, canWrite)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"articles": articles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// linkColtechArticleHandler for the "POST /v1/coltech_items/:id/kb_articles" endpoint
+func (app *application) linkColtechArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Article_id int64 `json:"article_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	article, err := app.models.Articles.Get(input.Article_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("article_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Articles.Link(article.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateLink):
+			v.AddError("article_id", "is already linked to this coltech item")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/kb_articles/%d", article.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"article": article}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlinkColtechArticleHandler for the "DELETE /v1/coltech_items/:id/kb_articles/:article_id" endpoint
+func (app *application) unlinkColtechArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	articleID, err := app.readInt64Param(r, "article_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Articles.Unlink(articleID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "article successfully unlinked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,423 @@
+// Filename: cmd/api/assets.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createAssetHandler for the "POST /v1/assets" endpoint
+func (app *application) createAssetHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Asset_tag    string    `json:"asset_tag"`
+		Type         string    `json:"type"`
+		Model        string    `json:"model"`
+		Serial       string    `json:"serial"`
+		Location     string    `json:"location"`
+		Owner_id     int64     `json:"owner_id"`
+		Status       string    `json:"status"`
+		Warranty_end time.Time `json:"warranty_end"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	asset := &data.Asset{
+		Asset_tag:    input.Asset_tag,
+		Type:         input.Type,
+		Model:        input.Model,
+		Serial:       input.Serial,
+		Location:     input.Location,
+		Owner_id:     input.Owner_id,
+		Status:       input.Status,
+		Warranty_end: input.Warranty_end,
+	}
+	if asset.Status == "" {
+		asset.Status = data.AssetInUse
+	}
+	v := validator.New()
+	data.ValidateAsset(v, asset)
+	err = app.checkAssetOwner(asset, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Assets.Insert(asset)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAssetTag):
+			v.AddError("asset_tag", "is already in use")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/assets/%d", asset.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"asset": asset}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showAssetHandler for the "GET /v1/assets/:id" endpoint
+func (app *application) showAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	asset, err := app.models.Assets.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"asset": asset}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAssetsHandler for the "GET /v1/assets" endpoint. Sorting by
+// -ticket_count puts the assets with the most coltech items first.
+func (app *application) listAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search   string
+		Type     string
+		Status   string
+		Location string
+		Owner_id int64
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Search = app.readString(qs, "search", "")
+	input.Type = app.readString(qs, "type", "")
+	input.Status = app.readString(qs, "status", "")
+	input.Location = app.readString(qs, "location", "")
+	input.Owner_id = int64(app.readInt(qs, "owner_id", 0, v))
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = []string{"id", "asset_tag", "type", "location", "warranty_end", "ticket_count", "-id", "-asset_tag", "-type", "-location", "-warranty_end", "-ticket_count"}
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.AssetStatuses...), "status", "must be in_stock, in_use, in_repair or retired")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	assets, metadata, err := app.models.Assets.GetAll(input.Search, input.Type, input.Status, input.Location, input.Owner_id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"assets": assets, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateAssetHandler for the "PATCH /v1/assets/:id" endpoint
+func (app *application) updateAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	asset, err := app.models.Assets.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Asset_tag    *string    `json:"asset_tag"`
+		Type         *string    `json:"type"`
+		Model        *string    `json:"model"`
+		Serial       *string    `json:"serial"`
+		Location     *string    `json:"location"`
+		Owner_id     *int64     `json:"owner_id"`
+		Status       *string    `json:"status"`
+		Warranty_end *time.Time `json:"warranty_end"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Asset_tag != nil {
+		asset.Asset_tag = *input.Asset_tag
+	}
+	if input.Type != nil {
+		asset.Type = *input.Type
+	}
+	if input.Model != nil {
+		asset.Model = *input.Model
+	}
+	if input.Serial != nil {
+		asset.Serial = *input.Serial
+	}
+	if input.Location != nil {
+		asset.Location = *input.Location
+	}
+	if input.Owner_id != nil {
+		asset.Owner_id = *input.Owner_id
+	}
+	if input.Status != nil {
+		asset.Status = *input.Status
+	}
+	if input.Warranty_end != nil {
+		asset.Warranty_end = *input.Warranty_end
+	}
+	v := validator.New()
+	data.ValidateAsset(v, asset)
+	err = app.checkAssetOwner(asset, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Assets.Update(asset)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAssetTag):
+			v.AddError("asset_tag", "is already in use")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"asset": asset}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAssetHandler for the "DELETE /v1/assets/:id" endpoint
+func (app *application) deleteAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Assets.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "asset successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAssetColtechsHandler for the "GET /v1/assets/:id/coltech_items" endpoint.
+// It is the asset's ticket history, newest first.
+func (app *application) listAssetColtechsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The order is fixed, the sort only has to pass validation
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Assets.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Only the coltech items the user can see are listed
+	viewer, err := app.viewer(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	coltechs, metadata, err := app.models.Assets.GetColtechs(id, filters, viewer)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"coltechs": coltechs, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listColtechAssetsHandler for the "GET /v1/coltech_items/:id/assets" endpoint
+func (app *application) listColtechAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	assets, err := app.models.Assets.GetAllForColtech(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"assets": assets}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// linkColtechAssetHandler for the "POST /v1/coltech_items/:id/assets" endpoint
+func (app *application) linkColtechAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Asset_id int64 `json:"asset_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	asset, err := app.models.Assets.Get(input.Asset_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("asset_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Assets.Link(asset.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAssetLink):
+			v.AddError("asset_id", "is already linked to this coltech item")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	asset.Ticket_count++
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/assets/%d", asset.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"asset": asset}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlinkColtechAssetHandler for the "DELETE /v1/coltech_items/:id/assets/:asset_id" endpoint
+func (app *application) unlinkColtechAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	assetID, err := app.readInt64Param(r, "asset_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Assets.Unlink(assetID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "asset successfully unlinked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkAssetOwner() adds a validation error when the asset's owner is not a
+// user. Assets do not need an owner.
+func (app *application) checkAssetOwner(asset *data.Asset, v *validator.Validator) error {
+	if asset.Owner_id == 0 {
+		return nil
+	}
+	_, err := app.models.Users.Get(asset.Owner_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("owner_id", "does not exist")
+		default:
+			return err
+		}
+	}
+	return nil
+}
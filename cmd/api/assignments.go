@@ -0,0 +1,203 @@
+// Filename: cmd/api/assignments.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// autoAssign() returns the email of the user that the department's assignment
+// rule picks for a new coltech item, or UNASSIGNED when there is no rule or
+// nobody in the rule's pool is available
+func (app *application) autoAssign(coltech *data.Coltech) (string, error) {
+	rule, err := app.models.Assignments.Match(coltech.Department, coltech.Category)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return data.Unassigned, nil
+		default:
+			return "", err
+		}
+	}
+	user, err := app.models.Assignments.PickAssignee(rule)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoAvailableAssignee):
+			return data.Unassigned, nil
+		default:
+			return "", err
+		}
+	}
+	return user.Email, nil
+}
+
+// createAssignmentRuleHandler for the "POST /v1/assignment_rules" endpoint
+func (app *application) createAssignmentRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Department string  `json:"department"`
+		Category   string  `json:"category"`
+		Strategy   string  `json:"strategy"`
+		User_ids   []int64 `json:"user_ids"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	rule := &data.AssignmentRule{
+		Department: input.Department,
+		Category:   input.Category,
+		Strategy:   input.Strategy,
+		User_ids:   input.User_ids,
+	}
+	v := validator.New()
+	if data.ValidateAssignmentRule(v, rule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Assignments.Insert(rule)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRule):
+			v.AddError("category", "a rule for this department and category already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/assignment_rules/%d", rule.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"assignment_rule": rule}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAssignmentRulesHandler for the "GET /v1/assignment_rules" endpoint
+func (app *application) listAssignmentRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := app.models.Assignments.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"assignment_rules": rules}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showAssignmentRuleHandler for the "GET /v1/assignment_rules/:id" endpoint
+func (app *application) showAssignmentRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	rule, err := app.models.Assignments.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"assignment_rule": rule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateAssignmentRuleHandler for the "PATCH /v1/assignment_rules/:id" endpoint
+func (app *application) updateAssignmentRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	rule, err := app.models.Assignments.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Department *string `json:"department"`
+		Category   *string `json:"category"`
+		Strategy   *string `json:"strategy"`
+		User_ids   []int64 `json:"user_ids"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Department != nil {
+		rule.Department = *input.Department
+	}
+	if input.Category != nil {
+		rule.Category = *input.Category
+	}
+	if input.Strategy != nil {
+		rule.Strategy = *input.Strategy
+	}
+	if input.User_ids != nil {
+		rule.User_ids = input.User_ids
+	}
+	v := validator.New()
+	if data.ValidateAssignmentRule(v, rule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Assignments.Update(rule)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateRule):
+			v.AddError("category", "a rule for this department and category already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"assignment_rule": rule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAssignmentRuleHandler for the "DELETE /v1/assignment_rules/:id" endpoint
+func (app *application) deleteAssignmentRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Assignments.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "assignment rule successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
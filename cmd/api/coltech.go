@@ -3,12 +3,15 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/patch"
 	"coltech.osborncollins.net/internal/validator"
 )
 
@@ -16,12 +19,20 @@ import (
 func (app *application) createCOLTECHItemHandler(w http.ResponseWriter, r *http.Request) {
 	// Our Target decode destination
 	var input struct {
-		Summary      string `json:"summary"`
-		Description  string `json:"description"`
-		Department   string `json:"department"`
-		Category     string `json:"category"`
-		Priority_val string `json:"priority_val"`
-		Created_by   string `json:"created_by"`
+		Summary         string            `json:"summary"`
+		Description     string            `json:"description"`
+		Department      string            `json:"department"`
+		Category        string            `json:"category"`
+		Priority_val    string            `json:"priority_val"`
+		Priority_reason string            `json:"priority_reason"`
+		Impact          string            `json:"impact"`
+		Urgency         string            `json:"urgency"`
+		Assigned_to     string            `json:"assigned_to"`
+		Created_by      string            `json:"created_by"`
+		Custom_fields   data.CustomValues `json:"custom_fields"`
+		Tags            []string          `json:"tags"`
+		Confidential    bool              `json:"confidential"`
+		Confidential_to []int64           `json:"confidential_to"`
 	}
 	// Initialize a new json.Decoder instance
 	err := app.readJSON(w, r, &input)
@@ -32,34 +43,132 @@ func (app *application) createCOLTECHItemHandler(w http.ResponseWriter, r *http.
 
 	//Copy the values from the input struct to a new coltech struct
 	coltech := &data.Coltech{
-		Summary:      input.Summary,
-		Description:  input.Description,
-		Department:   input.Department,
-		Category:     input.Category,
-		Priority_val: input.Priority_val,
-		Created_by:   input.Created_by,
+		Summary:         input.Summary,
+		Description:     input.Description,
+		Department:      input.Department,
+		Category:        input.Category,
+		Priority_val:    input.Priority_val,
+		Priority_reason: input.Priority_reason,
+		Impact:          input.Impact,
+		Urgency:         input.Urgency,
+		Assigned_to:     input.Assigned_to,
+		Created_by:      input.Created_by,
+		Requester_id:    app.contextGetUser(r).ID,
+		Custom_fields:   input.Custom_fields,
+		Tags:            input.Tags,
+		Confidential:    input.Confidential,
+		Confidential_to: input.Confidential_to,
 	}
 	// initialize a new Validator instance
 	v := validator.New()
 
+	// Requesters rate impact and urgency, only agents may pick the priority
+	err = app.checkPriorityOverride(r, &data.Coltech{}, coltech, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Only agents may make a coltech item confidential
+	err = app.checkConfidentialChange(r, &data.Coltech{}, coltech, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Fill in anything the client left out from the requested template
+	if name := r.URL.Query().Get("template"); name != "" {
+		template, err := app.models.Templates.GetByName(name)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("template", "does not exist")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		template.Apply(coltech)
+	}
+	err = app.derivePriority(coltech)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Get the custom field definitions for the coltech item's category
+	fields, err := app.models.CustomFields.GetAll(coltech.Category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	//Check the map to determine if there were any validation errors
-	if data.ValidateColtech(v, coltech); !v.Valid() {
+	if data.ValidateColtech(v, coltech, fields); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	// Hand the ticket out using the department's assignment rule
+	// if the client did not pick an assignee
+	if coltech.Assigned_to == "" {
+		coltech.Assigned_to, err = app.autoAssign(coltech)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Warn about open coltech items this one may repeat, looked for before
+	// the insert so that it does not find itself
+	duplicates, err := app.findDuplicates(r, coltech)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Categories with approval steps hold new coltech items until the
+	// approvers have signed them off
+	steps, err := app.models.Approvals.GetSteps(coltech.Category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// Create a Coltech Object
-	err = app.models.Coltechs.Insert(coltech)
+	approvals, err := app.models.Coltechs.InsertWithApprovals(coltech, app.contextGetUser(r).ID, steps)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The coltech item exists from here on, so the response points at it
+	// even if writing it fails and an Idempotency-Key is kept for it
+	w.Header().Set("Location", fmt.Sprintf("/v1/coltech_items/%d", coltech.ID))
+	if len(approvals) > 0 {
+		app.background(func() {
+			app.sendApprovalRequests(coltech, approvals)
+		})
+	}
+
+	// Let anyone mentioned in the description know about it. The coltech
+	// item has been created, so a failure here is logged rather than
+	// reported to a client that would then create it again.
+	unresolved, err := app.notifyMentions(coltech, app.contextGetUser(r), coltech.Description, "", "the description")
+	if err != nil {
+		app.logError(r, err)
+		unresolved = []string{}
+	}
+
+	// Point the client at knowledge base articles that may already solve it
+	suggested, err := app.models.Articles.Suggest(coltech.Summary, suggestedArticles)
+	if err != nil {
+		app.logError(r, err)
+		suggested = []*data.Article{}
 	}
 
-	// Create a location header for the newly created resource/Coltech object
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/coltech_items/%d", coltech.ID))
+	headers.Set("ETag", etag(coltech))
 	// Write the JSON response with 201 - created status code with the body
 	// being the actual coltech data and the header being the headers map
-	err = app.writeJSON(w, http.StatusCreated, envelope{"coltech": coltech}, headers)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"coltech": coltech, "suggested_articles": suggested, "possible_duplicates": duplicates, "unresolved_mentions": unresolved}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -72,8 +181,25 @@ func (app *application) showCOLTECHItemHandler(w http.ResponseWriter, r *http.Re
 		app.notFoundResponse(w, r)
 		return
 	}
-	// Fetch the specific coltech item
-	coltech, err := app.models.Coltechs.Get(id)
+	// Read the fields and related resources the client wants
+	v := validator.New()
+	fs := app.readFieldset(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// The version is always needed for the ETag
+	columns := fs.columns()
+	if columns != nil {
+		columns = append(columns, "version")
+	}
+	// Fetch the specific coltech item, one the user may not see is not found
+	viewer, err := app.viewer(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	coltech, err := app.models.Coltechs.GetFields(id, columns, viewer)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -83,8 +209,34 @@ func (app *application) showCOLTECHItemHandler(w http.ResponseWriter, r *http.Re
 		}
 		return
 	}
+	// Shape the coltech item the way the client asked. A partial
+	// representation gets its own weak tag so that it is never taken for the
+	// full one or a differently shaped one.
+	var representation interface{} = coltech
+	tag := etag(coltech)
+	if !fs.full() {
+		items, err := app.presentColtechs([]*data.Coltech{coltech}, fs)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		representation = items[0]
+		tag, err = partialETag(coltech.Version, representation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	// Tell the client when the copy it already holds is still current
+	if match := r.Header.Get("If-None-Match"); match != "" && matchETag(match, tag) {
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", tag)
 	// Write the response by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"coltech": coltech}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"coltech": representation}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -99,7 +251,7 @@ func (app *application) updateCOLTECHItemHandler(w http.ResponseWriter, r *http.
 		return
 	}
 	// Fetch the original record from the database
-	coltech, err := app.models.Coltechs.Get(id)
+	coltech, err := app.getColtech(r, id)
 	// Error handling
 	if err != nil {
 		switch {
@@ -110,75 +262,88 @@ func (app *application) updateCOLTECHItemHandler(w http.ResponseWriter, r *http.
 		}
 		return
 	}
-	// Create an input struct to hold data read in from the client
-	// We update the input struct to use pointers because pointers have a
-	// default value of nil false
-	// if a field remains nil then we know that the client did not update it
-	var input struct {
-		Summary      *string    `json:"summary"`
-		Description  *string    `json:"desription"`
-		Priority_val *string    `json:"priority_val"`
-		Status_val   *string    `json:"status_val"`
-		Assigned_to  *string    `json:"assigned_to"`
-		Category     *string    `json:"category"`
-		Department   *string    `json:"department"`
-		Closed_on    *time.Time `json:"closed_on"`
-		Created_by   *string    `json:"created_by"`
-		Due_on       *time.Time `json:"due_on"`
-	}
-
-	//Initalize a new json.Decoder instance
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	// Refuse the update when the client's copy is out of date, otherwise its
+	// changes would overwrite someone else's
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !matchVersion(ifMatch, coltech.Version) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
-	// Check for updates
-	if input.Summary != nil {
-		coltech.Summary = *input.Summary
-	}
-	if input.Description != nil {
-		coltech.Description = *input.Description
-	}
-	if input.Priority_val != nil {
-		coltech.Priority_val = *input.Priority_val
-	}
-	if input.Status_val != nil {
-		coltech.Status_val = *input.Status_val
-	}
-	if input.Assigned_to != nil {
-		coltech.Assigned_to = *input.Assigned_to
-	}
-	if input.Category != nil {
-		coltech.Category = *input.Category
-	}
-	if input.Department != nil {
-		coltech.Department = *input.Department
-	}
-	if input.Closed_on != nil {
-		coltech.Closed_on = *input.Closed_on
-	}
-	if input.Created_by != nil {
-		coltech.Created_by = *input.Created_by
+	// Keep a copy of the original so that the changes can be recorded
+	original := *coltech
+	// Apply the changes in whichever format the client sent them
+	switch requestMediaType(r) {
+	case patch.MergePatchType, patch.JSONPatchType:
+		err = app.readColtechPatch(w, r, coltech)
+	case "", "application/json":
+		err = app.readColtechInput(w, r, coltech)
+	default:
+		w.Header().Set("Accept-Patch", "application/json, "+patch.MergePatchType+", "+patch.JSONPatchType)
+		app.unsupportedMediaTypeResponse(w, r)
+		return
 	}
-	if input.Due_on != nil {
-		coltech.Due_on = *input.Due_on
+	if err != nil {
+		switch {
+		case errors.Is(err, patch.ErrTestFailed):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		case errors.Is(err, patch.ErrInvalidPatch):
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
 	}
-
+	closing := app.markClosed(&original, coltech)
 	// Perform Validation on the updated coltech item. If validation fails then
 	// we send a 422 - unprocessable entity response to the client
 	// initialize a new Validator instance
 	v := validator.New()
 
+	// Only agents may override the priority, everyone else gets the one the
+	// matrix gives the new impact and urgency
+	err = app.checkPriorityOverride(r, &original, coltech, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Likewise only they may change who can see a confidential coltech item
+	err = app.checkConfidentialChange(r, &original, coltech, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.derivePriority(coltech)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Get the custom field definitions for the coltech item's category
+	fields, err := app.models.CustomFields.GetAll(coltech.Category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	//Check the map to determine if there were any validation errors
-	if data.ValidateColtech(v, coltech); !v.Valid() {
+	data.ValidateStatusTransition(v, &original, coltech)
+	if data.ValidateColtech(v, coltech, fields); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Pass the update coltech record to the Update() method
-	err = app.models.Coltechs.Update(coltech)
+	// A coltech item moved into a category with approval steps waits for them
+	steps, err := app.recategorisedSteps(&original, coltech)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Pass the update coltech record and what changed to the UpdateWithHistory() method
+	user := app.contextGetUser(r)
+	history := data.DiffColtech(&original, coltech, user.ID, "")
+	approvals, err := app.models.Coltechs.UpdateWithHistory(coltech, user.ID, history, nil, steps)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && ifMatch != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -186,7 +351,28 @@ func (app *application) updateCOLTECHItemHandler(w http.ResponseWriter, r *http.
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusCreated, envelope{"coltech": coltech}, nil)
+	if len(approvals) > 0 {
+		app.background(func() {
+			app.sendApprovalRequests(coltech, approvals)
+		})
+	}
+	// Only people newly mentioned in the description are notified. The
+	// update has been saved, so a failure here is logged rather than
+	// reported to a client that would retry it with a stale version.
+	unresolved, err := app.notifyMentions(coltech, user, coltech.Description, original.Description, "the description")
+	if err != nil {
+		app.logError(r, err)
+		unresolved = []string{}
+	}
+	// Ask the requester how we did
+	if closing {
+		app.background(func() {
+			app.sendSurvey(coltech)
+		})
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag(coltech))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"coltech": coltech, "unresolved_mentions": unresolved}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -200,12 +386,38 @@ func (app *application) deleteCOLTECHItemHandler(w http.ResponseWriter, r *http.
 		app.notFoundResponse(w, r)
 		return
 	}
+	viewer, err := app.viewer(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Only delete the version the client has seen when it sends If-Match
+	var version int32
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		coltech, err := app.models.Coltechs.Get(id, viewer)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !matchVersion(ifMatch, coltech.Version) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = coltech.Version
+	}
 	// Delete the coltech item from the database. Send a 404 Not Found status code to the
 	// client if there is no matching record
-	err = app.models.Coltechs.Delete(id)
+	err = app.models.Coltechs.Delete(id, version, viewer)
 	// Error handling
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
@@ -229,6 +441,7 @@ func (app *application) listCOLTECHItemsHandler(w http.ResponseWriter, r *http.R
 		Assigned_to  string
 		Priority_val string
 		Status_val   string
+		Custom       map[string]string
 		data.Filters
 	}
 	// Initialize a validator
@@ -240,6 +453,8 @@ func (app *application) listCOLTECHItemsHandler(w http.ResponseWriter, r *http.R
 	input.Assigned_to = app.readString(qs, "assigned_to", "")
 	input.Priority_val = app.readString(qs, "priority_val", "")
 	input.Status_val = app.readString(qs, "status_val", "")
+	// Custom fields are filtered with custom_fields.<name>=<value>
+	input.Custom = app.readPrefixed(qs, "custom_fields.", v)
 	// Get the page information using the read int method
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
@@ -247,17 +462,37 @@ func (app *application) listCOLTECHItemsHandler(w http.ResponseWriter, r *http.R
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	// Specify the allowed sort values
 	input.Filters.SortList = []string{"id", "created_by", "priority_val", "assigned_to", "status_val", "-id", "-created_by", "-priority_val", "-assigned_to", "-status_val"}
+	// Get the fields and related resources to return
+	fs := app.readFieldset(qs, v)
 	// Check for validation errors
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Get a listing of all coltech items
-	coltechs, metadata, err := app.models.Coltechs.GetAll(input.Created_by, input.Assigned_to, input.Status_val, input.Priority_val, input.Filters)
+	// Get a listing of the coltech items the user can see
+	viewer, err := app.viewer(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	coltechs, metadata, err := app.models.Coltechs.GetAll(input.Created_by, input.Assigned_to, input.Status_val, input.Priority_val, input.Custom, fs.columns(), input.Filters, viewer)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	// Send only what was asked for when the client picked fields or includes
+	if !fs.full() {
+		items, err := app.presentColtechs(coltechs, fs)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeJSON(w, http.StatusOK, envelope{"coltechs": items, "metadata": metadata}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
 	// Send a JSON response containing all the coltech items
 	err = app.writeJSON(w, http.StatusOK, envelope{"coltechs": coltechs, "metadata": metadata}, nil)
 	if err != nil {
@@ -265,3 +500,165 @@ func (app *application) listCOLTECHItemsHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 }
+
+// markClosed() sets the closed time when a coltech item moves to CLOSED and
+// reports whether it did so the caller can send the satisfaction survey
+func (app *application) markClosed(original, coltech *data.Coltech) bool {
+	closing := original.Status_val != data.StatusClosed && coltech.Status_val == data.StatusClosed
+	if closing && coltech.Closed_on.IsZero() {
+		coltech.Closed_on = time.Now()
+	}
+	return closing
+}
+
+// readColtechInput() applies a plain JSON update to the coltech item, only
+// the fields the client sent are changed
+func (app *application) readColtechInput(w http.ResponseWriter, r *http.Request, coltech *data.Coltech) error {
+	// Create an input struct to hold data read in from the client
+	// We update the input struct to use pointers because pointers have a
+	// default value of nil false
+	// if a field remains nil then we know that the client did not update it
+	var input struct {
+		Summary         *string           `json:"summary"`
+		Description     *string           `json:"description"`
+		Priority_val    *string           `json:"priority_val"`
+		Priority_reason *string           `json:"priority_reason"`
+		Impact          *string           `json:"impact"`
+		Urgency         *string           `json:"urgency"`
+		Status_val      *string           `json:"status_val"`
+		Assigned_to     *string           `json:"assigned_to"`
+		Category        *string           `json:"category"`
+		Department      *string           `json:"department"`
+		Closed_on       *time.Time        `json:"closed_on"`
+		Created_by      *string           `json:"created_by"`
+		Due_on          *time.Time        `json:"due_on"`
+		Custom_fields   data.CustomValues `json:"custom_fields"`
+		Tags            []string          `json:"tags"`
+		Confidential    *bool             `json:"confidential"`
+		Confidential_to []int64           `json:"confidential_to"`
+	}
+
+	//Initalize a new json.Decoder instance
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		return err
+	}
+	// Check for updates
+	if input.Summary != nil {
+		coltech.Summary = *input.Summary
+	}
+	if input.Description != nil {
+		coltech.Description = *input.Description
+	}
+	if input.Priority_val != nil {
+		coltech.Priority_val = *input.Priority_val
+	}
+	if input.Priority_reason != nil {
+		coltech.Priority_reason = *input.Priority_reason
+	}
+	if input.Impact != nil {
+		coltech.Impact = *input.Impact
+	}
+	if input.Urgency != nil {
+		coltech.Urgency = *input.Urgency
+	}
+	if input.Status_val != nil {
+		coltech.Status_val = *input.Status_val
+	}
+	if input.Assigned_to != nil {
+		coltech.Assigned_to = *input.Assigned_to
+	}
+	if input.Category != nil {
+		coltech.Category = *input.Category
+	}
+	if input.Department != nil {
+		coltech.Department = *input.Department
+	}
+	if input.Closed_on != nil {
+		coltech.Closed_on = *input.Closed_on
+	}
+	if input.Created_by != nil {
+		coltech.Created_by = *input.Created_by
+	}
+	if input.Due_on != nil {
+		coltech.Due_on = *input.Due_on
+	}
+	if input.Custom_fields != nil {
+		coltech.Custom_fields = input.Custom_fields
+	}
+	if input.Tags != nil {
+		coltech.Tags = input.Tags
+	}
+	if input.Confidential != nil {
+		coltech.Confidential = *input.Confidential
+	}
+	if input.Confidential_to != nil {
+		coltech.Confidential_to = input.Confidential_to
+	}
+	return nil
+}
+
+// The fields of a coltech item that a patch may test but not change
+var readOnlyColtechFields = []string{"id", "key", "created_on", "requester_id", "time_spent_minutes", "billable_minutes", "version"}
+
+// readColtechPatch() applies a JSON Merge Patch or JSON Patch document to the
+// coltech item's JSON representation. A member missing from the result, such
+// as one set to null in a merge patch, clears that field.
+func (app *application) readColtechPatch(w http.ResponseWriter, r *http.Request, coltech *data.Coltech) error {
+	original, err := json.Marshal(coltech)
+	if err != nil {
+		return err
+	}
+	var doc []byte
+	if requestMediaType(r) == patch.MergePatchType {
+		var input json.RawMessage
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			return err
+		}
+		doc, err = patch.Merge(original, input)
+	} else {
+		var input []patch.Operation
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			return err
+		}
+		doc, err = patch.Apply(original, input)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Both documents come from json.Marshal() so unchanged members are
+	// byte for byte the same
+	var current, patched map[string]json.RawMessage
+	err = json.Unmarshal(original, &current)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(doc, &patched)
+	if err != nil {
+		return fmt.Errorf("%w: the result must be a JSON object", patch.ErrInvalidPatch)
+	}
+	for _, field := range readOnlyColtechFields {
+		if !bytes.Equal(patched[field], current[field]) {
+			return fmt.Errorf("%w: %s cannot be changed", patch.ErrInvalidPatch, field)
+		}
+	}
+
+	var updated data.Coltech
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&updated)
+	if err != nil {
+		return fmt.Errorf("%w: %s", patch.ErrInvalidPatch, err)
+	}
+	if updated.Tags == nil {
+		updated.Tags = []string{}
+	}
+	if updated.Confidential_to == nil {
+		updated.Confidential_to = []int64{}
+	}
+	*coltech = updated
+	return nil
+}
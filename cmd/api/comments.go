@@ -0,0 +1,125 @@
+// Filename: cmd/api/comments.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createCommentHandler for the "POST /v1/coltech_items/:id/comments" endpoint
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	coltech, err := app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Body string `json:"body"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	comment := &data.Comment{
+		Coltech_id: coltech.ID,
+		User_id:    user.ID,
+		Author:     user.Name,
+		Body:       input.Body,
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Coltechs.AddComment(coltech, comment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The comment has been saved, so a failure here is logged rather than
+	// reported to a client that would post it again
+	unresolved, err := app.notifyMentions(coltech, user, comment.Body, "", "a comment")
+	if err != nil {
+		app.logError(r, err)
+		unresolved = []string{}
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/coltech_items/%d/comments", coltech.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"comment": comment, "unresolved_mentions": unresolved}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommentsHandler for the "GET /v1/coltech_items/:id/comments" endpoint
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	coltech, err := app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	comments, err := app.models.Comments.GetAllForColtech(coltech.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"comments": comments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listHistoryHandler for the "GET /v1/coltech_items/:id/history" endpoint
+func (app *application) listHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	coltech, err := app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	history, err := app.models.History.GetAllForColtech(coltech.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"history": history}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Filename: cmd/api/customfields.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createCustomFieldHandler for the "POST /v1/custom_fields" endpoint
+func (app *application) createCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Category string   `json:"category"`
+		Name     string   `json:"name"`
+		Label    string   `json:"label"`
+		Type     string   `json:"type"`
+		Options  []string `json:"options"`
+		Required bool     `json:"required"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	field := &data.CustomField{
+		Category: input.Category,
+		Name:     input.Name,
+		Label:    input.Label,
+		Type:     input.Type,
+		Options:  input.Options,
+		Required: input.Required,
+	}
+	if field.Options == nil {
+		field.Options = []string{}
+	}
+	v := validator.New()
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.CustomFields.Insert(field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateField):
+			v.AddError("name", "a field with this name already exists for the category")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/custom_fields/%d", field.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"custom_field": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCustomFieldsHandler for the "GET /v1/custom_fields" endpoint, which
+// can be narrowed down to one category with ?category=
+func (app *application) listCustomFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	category := app.readString(r.URL.Query(), "category", "")
+	fields, err := app.models.CustomFields.GetAll(category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"custom_fields": fields}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCustomFieldHandler for the "PATCH /v1/custom_fields/:id" endpoint
+func (app *application) updateCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	field, err := app.models.CustomFields.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The category, name and type cannot be changed once created
+	var input struct {
+		Label    *string  `json:"label"`
+		Options  []string `json:"options"`
+		Required *bool    `json:"required"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Label != nil {
+		field.Label = *input.Label
+	}
+	if input.Options != nil {
+		field.Options = input.Options
+	}
+	if input.Required != nil {
+		field.Required = *input.Required
+	}
+	v := validator.New()
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.CustomFields.Update(field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"custom_field": field}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCustomFieldHandler for the "DELETE /v1/custom_fields/:id" endpoint
+func (app *application) deleteCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.CustomFields.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "custom field successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,65 @@
+// Filename: cmd/api/duplicates.go
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The number of possible duplicates returned and how far back they are
+// looked for
+const (
+	possibleDuplicates = 5
+	duplicateWindow    = 30 * 24 * time.Hour
+)
+
+// similarColtechsHandler for the "POST /v1/coltech_similar" endpoint. It
+// previews the possible duplicates a new coltech item would be warned about
+// without creating it.
+func (app *application) similarColtechsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+		Department  string `json:"department"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Summary != "" || input.Description != "", "summary", "must be provided when there is no description")
+	v.Check(input.Department != "", "department", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	duplicates, err := app.findDuplicates(r, &data.Coltech{
+		Summary:     input.Summary,
+		Description: input.Description,
+		Department:  input.Department,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"possible_duplicates": duplicates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// findDuplicates() returns the recent open coltech items in the same
+// department, that the request's user can see, that look like the coltech item
+func (app *application) findDuplicates(r *http.Request, coltech *data.Coltech) ([]*data.PossibleDuplicate, error) {
+	viewer, err := app.viewer(r)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-duplicateWindow)
+	return app.models.Coltechs.GetSimilar(coltech.Summary, coltech.Description, coltech.Department, since, possibleDuplicates, viewer)
+}
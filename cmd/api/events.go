@@ -0,0 +1,290 @@
+// Filename: cmd/api/events.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	// Streams end before the server's write timeout and the client reconnects
+	// with Last-Event-ID, so no events are lost between streams
+	eventStreamDuration = writeTimeout - 5*time.Second
+	// How often a comment line is sent so proxies keep the connection open
+	eventHeartbeat = 10 * time.Second
+	// How long the client should wait before reconnecting, in milliseconds
+	eventRetry = 1000
+	// The most events replayed to a reconnecting client in one stream
+	eventReplayLimit = 500
+)
+
+// eventBroker fans events out to the open streams on this instance
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan *data.Event]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[chan *data.Event]struct{})}
+}
+
+// subscribe() returns a channel that receives every published event
+func (b *eventBroker) subscribe() chan *data.Event {
+	ch := make(chan *data.Event, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// unsubscribe() stops sending events to the channel
+func (b *eventBroker) unsubscribe(ch chan *data.Event) {
+	b.mu.Lock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
+
+// publish() sends the event to every subscriber. A subscriber that has fallen
+// too far behind is dropped, its stream ends and the client catches up from
+// the database when it reconnects.
+func (b *eventBroker) publish(event *data.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// runEventListener() listens for the events recorded by every API instance
+// and publishes them to this instance's streams until the server shuts down
+func (app *application) runEventListener() {
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"listener": data.EventsChannel})
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(data.EventsChannel)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"listener": data.EventsChannel})
+		return
+	}
+	// The id of the newest event published, used to catch up after the
+	// connection to the database has been lost
+	var lastID int64
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established and
+			// notifications sent while it was down have been lost
+			if n == nil {
+				lastID = app.publishEventsSince(lastID)
+				continue
+			}
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"notification": n.Extra})
+				continue
+			}
+			event, err := app.models.Events.Get(id)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"event_id": n.Extra})
+				continue
+			}
+			app.events.publish(event)
+			if id > lastID {
+				lastID = id
+			}
+		case <-ping.C:
+			// Make sure a silently dropped connection is noticed
+			go listener.Ping()
+		}
+	}
+}
+
+// publishEventsSince() publishes the events recorded after lastID and
+// returns the id of the newest one
+func (app *application) publishEventsSince(lastID int64) int64 {
+	if lastID == 0 {
+		return lastID
+	}
+	events, err := app.models.Events.GetSince(lastID, eventReplayLimit)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return lastID
+	}
+	for _, event := range events {
+		app.events.publish(event)
+		lastID = event.ID
+	}
+	return lastID
+}
+
+// runEventPruner() removes old events until the server shuts down
+func (app *application) runEventPruner() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+			_, err := app.models.Events.DeleteOlderThan(time.Now().Add(-app.config.events.retention))
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}
+}
+
+// eventsHandler for the "GET /v1/events" endpoint. It streams coltech item
+// events as Server-Sent Events, filtered like the coltech item listing.
+func (app *application) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	filter := data.EventFilter{
+		Created_by:   app.readString(qs, "created_by", ""),
+		Assigned_to:  app.readString(qs, "assigned_to", ""),
+		Priority_val: app.readString(qs, "priority_val", ""),
+		Status_val:   app.readString(qs, "status_val", ""),
+		Custom:       app.readPrefixed(qs, "custom_fields.", v),
+	}
+	// Browsers send Last-Event-ID when they reconnect, other clients may
+	// find the query parameter easier
+	lastID := app.readString(qs, "last_event_id", r.Header.Get("Last-Event-ID"))
+	var since int64
+	if lastID != "" {
+		var err error
+		since, err = strconv.ParseInt(lastID, 10, 64)
+		v.Check(err == nil && since >= 0, "last_event_id", "must be a positive integer")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only events for coltech items the user can see are sent. Watching
+	// is looked up once, the stream ends before it gets far out of date.
+	viewer, err := app.viewer(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	watched, err := app.models.Coltechs.GetWatchedIDs(viewer.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+
+	// Subscribe before replaying so that nothing recorded in between is missed
+	events := app.events.subscribe()
+	defer app.events.unsubscribe(events)
+
+	var backlog []*data.Event
+	if lastID != "" {
+		backlog, err = app.models.Events.GetSince(since, eventReplayLimit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+
+	// Events can commit out of id order so live events are only skipped when
+	// they were already sent as part of the replay
+	replayed := make(map[int64]bool, len(backlog))
+	send := func(event *data.Event) bool {
+		if replayed[event.ID] {
+			return true
+		}
+		if !filter.Matches(event) || !viewer.CanSee(event.Coltech, watched[event.Coltech_id]) {
+			return true
+		}
+		js, err := json.Marshal(event)
+		if err != nil {
+			app.logError(r, err)
+			return false
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, js)
+		return err == nil
+	}
+	for _, event := range backlog {
+		if !send(event) {
+			return
+		}
+		replayed[event.ID] = true
+	}
+	// A full backlog means there may be more, end the stream so the client
+	// comes straight back for the next batch
+	if len(backlog) == eventReplayLimit {
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	end := time.NewTimer(eventStreamDuration)
+	defer end.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok || !send(event) {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			// Stop streaming to users who have lost access since they connected
+			ok, err := app.hasPermission(r, "coltech_items:read")
+			if err != nil || !ok {
+				return
+			}
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-end.C:
+			return
+		case <-r.Context().Done():
+			return
+		case <-app.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Filename: cmd/api/fieldsets.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The related resources that can be embedded in coltech items with include=
+const (
+	includeAssignee      = "assignee"
+	includeLatestComment = "latest_comment"
+	includeTags          = "tags"
+)
+
+// A fieldset is the shape a client asked for coltech items to be returned in
+type fieldset struct {
+	fields   []string
+	includes []string
+}
+
+// readFieldset() reads the fields= and include= query string parameters
+func (app *application) readFieldset(qs url.Values, v *validator.Validator) fieldset {
+	fs := fieldset{
+		fields:   app.readCSV(qs, "fields", nil),
+		includes: app.readCSV(qs, "include", nil),
+	}
+	data.ValidateColtechFields(v, fs.fields)
+	for _, include := range fs.includes {
+		v.Check(validator.In(include, includeAssignee, includeLatestComment, includeTags), "include", "must only contain assignee, latest_comment or tags")
+	}
+	return fs
+}
+
+// full() reports whether the coltech items should be returned as they are
+func (fs fieldset) full() bool {
+	return len(fs.fields) == 0 && len(fs.includes) == 0
+}
+
+// has() reports whether the related resource was asked for
+func (fs fieldset) has(include string) bool {
+	return validator.In(include, fs.includes...)
+}
+
+// columns() returns the fields to select, adding those the embedded
+// resources are built from. Nil means every field.
+func (fs fieldset) columns() []string {
+	if len(fs.fields) == 0 {
+		return nil
+	}
+	columns := append([]string{}, fs.fields...)
+	if fs.has(includeAssignee) {
+		columns = append(columns, "assigned_to")
+	}
+	if fs.has(includeTags) {
+		columns = append(columns, "tags")
+	}
+	return columns
+}
+
+// presentColtechs() shapes coltech items for the response: only the id and
+// requested fields are kept and the requested related resources are looked
+// up for the whole page at once and embedded
+func (app *application) presentColtechs(coltechs []*data.Coltech, fs fieldset) ([]map[string]interface{}, error) {
+	var assignees map[string]*data.User
+	if fs.has(includeAssignee) {
+		emails := make([]string, 0, len(coltechs))
+		for _, coltech := range coltechs {
+			if coltech.Assigned_to != "" && coltech.Assigned_to != data.Unassigned {
+				emails = append(emails, coltech.Assigned_to)
+			}
+		}
+		users, err := app.models.Users.GetAllByEmail(emails)
+		if err != nil {
+			return nil, err
+		}
+		// Emails are case insensitive in the database
+		assignees = make(map[string]*data.User, len(users))
+		for _, user := range users {
+			assignees[strings.ToLower(user.Email)] = user
+		}
+	}
+	var comments map[int64]*data.Comment
+	if fs.has(includeLatestComment) {
+		ids := make([]int64, len(coltechs))
+		for i, coltech := range coltechs {
+			ids[i] = coltech.ID
+		}
+		var err error
+		comments, err = app.models.Comments.GetLatestForColtechs(ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]map[string]interface{}, len(coltechs))
+	for i, coltech := range coltechs {
+		js, err := json.Marshal(coltech)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		err = json.Unmarshal(js, &all)
+		if err != nil {
+			return nil, err
+		}
+		item := make(map[string]interface{})
+		if len(fs.fields) == 0 {
+			for field, value := range all {
+				item[field] = value
+			}
+		} else {
+			item["id"] = all["id"]
+			for _, field := range fs.fields {
+				item[field] = all[field]
+			}
+		}
+		if fs.has(includeAssignee) {
+			// A nil user is encoded as null when nobody is assigned
+			item[includeAssignee] = assignees[strings.ToLower(coltech.Assigned_to)]
+		}
+		if fs.has(includeLatestComment) {
+			item[includeLatestComment] = comments[coltech.ID]
+		}
+		if fs.has(includeTags) {
+			item[includeTags] = coltech.Tags
+		}
+		items[i] = item
+	}
+	return items, nil
+}
@@ -6,12 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"coltech.osborncollins.net/internal/data"
 	"coltech.osborncollins.net/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
@@ -20,12 +24,18 @@ import (
 type envelope map[string]interface{}
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+// The readInt64Param() method returns a named route parameter that must
+// be a positive integer
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	// Use the "ParamsFromContext()" function to get the request context as a slice
 	params := httprouter.ParamsFromContext(r.Context())
-	// Get the value of the "id" parameter
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	// Get the value of the named parameter
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
@@ -118,6 +128,41 @@ func (app *application) readString(qs url.Values, key string, defaultValue strin
 	return value
 }
 
+// The readPrefixed() method collects every query string parameter whose key
+// starts with prefix into a map keyed by the rest of the key. Keys that are
+// not valid field names are added to the validation errors map.
+func (app *application) readPrefixed(qs url.Values, prefix string, v *validator.Validator) map[string]string {
+	values := make(map[string]string)
+	for key := range qs {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, prefix)
+		if !validator.Matches(name, data.FieldNameRx) {
+			v.AddError(key, "is not a valid field name")
+			continue
+		}
+		values[name] = qs.Get(key)
+	}
+	return values
+}
+
+// The readCSV() method splits a comma separated query string value into a
+// slice, or returns the default value if no matching key is found
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	values := []string{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
 // The readInt() method converts a string value from the query string to an integer value
 // If the value cannot be converted to an integer then a validation error is added to
 // the validations errors map.
@@ -136,6 +181,91 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return intValue
 }
 
+// The readDate() method converts a YYYY-MM-DD value from the query string to a
+// time.Time. If the value cannot be parsed then a validation error is added to
+// the validations errors map.
+func (app *application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	// Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	// Perform the conversion to a date
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		v.AddError(key, "must be a date in the format YYYY-MM-DD")
+		return defaultValue
+	}
+	return date
+}
+
+// The requestMediaType() function returns the media type of the request body
+// without any parameters such as charset
+func requestMediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
+
+// The etag() function returns the entity tag for a coltech item. Its work
+// totals are tagged along with its version since logging time changes them
+// without changing the coltech item itself.
+func etag(coltech *data.Coltech) string {
+	return fmt.Sprintf(`"%d-%d-%d"`, coltech.Version, coltech.Time_spent, coltech.Billable_time)
+}
+
+// The partialETag() function returns a weak entity tag for a partial
+// representation of a record, such as one shaped with fields= and include=.
+// The representation itself is hashed so that each shape, and any related
+// resources embedded in it, gets its own tag.
+func partialETag(version int32, representation interface{}) (string, error) {
+	js, err := json.Marshal(representation)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write(js)
+	return fmt.Sprintf(`W/"%d-%x"`, version, h.Sum64()), nil
+}
+
+// The matchETag() function reports whether an If-None-Match header value, a
+// list of entity tags or "*", includes the given entity tag. Weak tags are
+// compared as if they were strong.
+func matchETag(header string, tag string) bool {
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// The matchVersion() function reports whether an If-Match header value, a
+// list of entity tags or "*", includes a tag for the given version. Only the
+// version is compared so that time logged by someone else does not stop an
+// edit to fields that have not changed.
+func matchVersion(header string, version int32) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" {
+			return true
+		}
+		tagged := strings.SplitN(strings.Trim(candidate, `"`), "-", 2)[0]
+		if tagged == strconv.Itoa(int(version)) {
+			return true
+		}
+	}
+	return false
+}
+
 // Background accepts a function as its parameter
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter
@@ -0,0 +1,155 @@
+// Filename: cmd/api/idempotency.go
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+)
+
+const (
+	// How long a response is kept for replaying to retries
+	idempotencyTTL = 24 * time.Hour
+	// The longest Idempotency-Key header accepted
+	idempotencyKeyMaxLength = 255
+)
+
+// The response headers that are stored and replayed along with the body
+var idempotentHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// responseRecorder passes a response through to the client while keeping a
+// copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent() makes a create endpoint safe to retry. The first request with
+// an Idempotency-Key header runs as normal and its response is stored, later
+// requests from the same user with the same key and body get that response
+// back instead of creating another record.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		user := app.contextGetUser(r)
+		if key == "" || user.IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			app.badRequestResponse(w, r, fmt.Errorf("Idempotency-Key header must not be more than %d bytes long", idempotencyKeyMaxLength))
+			return
+		}
+		// Read the body here to fingerprint it and hand the handler a copy
+		maxBytes := 1_048_576
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytes))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(r, body)
+
+		existing, err := app.models.Idempotency.Reserve(user.ID, key, fingerprint, idempotencyTTL)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				app.idempotencyKeyReusedResponse(w, r)
+			case existing.Pending():
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				for name, value := range existing.Headers {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status_code)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		// Give the key up if the handler panics so that the client can retry
+		completed := false
+		defer func() {
+			if !completed {
+				app.models.Idempotency.Release(user.ID, key)
+			}
+		}()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// Server errors are not stored, a retry may well succeed. Once the
+		// handler has set a Location the record exists though, and a retry
+		// would create another one.
+		if rec.status >= http.StatusInternalServerError && rec.Header().Get("Location") == "" {
+			return
+		}
+		headers := make(map[string]string)
+		for _, name := range idempotentHeaders {
+			if value := rec.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		err = app.models.Idempotency.Complete(user.ID, key, rec.status, headers, rec.body.Bytes())
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+		completed = true
+	})
+}
+
+// requestFingerprint() identifies a request by its method, URL and body so
+// that a key reused for a different request can be spotted
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// runIdempotencyPruner() removes expired idempotency keys until the server
+// shuts down
+func (app *application) runIdempotencyPruner() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+			_, err := app.models.Idempotency.DeleteExpired()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,378 @@
+// Filename: cmd/api/macros.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createMacroHandler for the "POST /v1/macros" endpoint
+func (app *application) createMacroHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string   `json:"name"`
+		Description  string   `json:"description"`
+		Shared       bool     `json:"shared"`
+		Status_val   string   `json:"status_val"`
+		Priority_val string   `json:"priority_val"`
+		Assigned_to  string   `json:"assigned_to"`
+		Category     string   `json:"category"`
+		Department   string   `json:"department"`
+		Add_tags     []string `json:"add_tags"`
+		Remove_tags  []string `json:"remove_tags"`
+		Comment      string   `json:"comment"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Macros belong to the agent who created them
+	macro := &data.Macro{
+		Name:         input.Name,
+		Description:  input.Description,
+		Owner_id:     app.contextGetUser(r).ID,
+		Shared:       input.Shared,
+		Status_val:   input.Status_val,
+		Priority_val: input.Priority_val,
+		Assigned_to:  input.Assigned_to,
+		Category:     input.Category,
+		Department:   input.Department,
+		Add_tags:     input.Add_tags,
+		Remove_tags:  input.Remove_tags,
+		Comment:      input.Comment,
+	}
+	v := validator.New()
+	if data.ValidateMacro(v, macro); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Macros.Insert(macro)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateMacro):
+			v.AddError("name", "you already have a macro with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/macros/%d", macro.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"macro": macro}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMacrosHandler for the "GET /v1/macros" endpoint
+func (app *application) listMacrosHandler(w http.ResponseWriter, r *http.Request) {
+	macros, err := app.models.Macros.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"macros": macros}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMacroHandler for the "GET /v1/macros/:id" endpoint
+func (app *application) showMacroHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	macro, err := app.models.Macros.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"macro": macro}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnMacro() fetches the macro named in the URL for changing. Only the
+// owner or an admin may change a macro, everyone else gets a 403 Forbidden.
+// It sends the response itself and returns nil when the macro can't be used.
+func (app *application) readOwnMacro(w http.ResponseWriter, r *http.Request) *data.Macro {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	user := app.contextGetUser(r)
+	macro, err := app.models.Macros.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	if macro.Owner_id != user.ID {
+		isAdmin, err := app.hasPermission(r, "admin:access")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil
+		}
+		if !isAdmin {
+			app.notPermittedResponse(w, r)
+			return nil
+		}
+	}
+	return macro
+}
+
+// updateMacroHandler for the "PATCH /v1/macros/:id" endpoint
+func (app *application) updateMacroHandler(w http.ResponseWriter, r *http.Request) {
+	macro := app.readOwnMacro(w, r)
+	if macro == nil {
+		return
+	}
+	var input struct {
+		Name         *string  `json:"name"`
+		Description  *string  `json:"description"`
+		Shared       *bool    `json:"shared"`
+		Status_val   *string  `json:"status_val"`
+		Priority_val *string  `json:"priority_val"`
+		Assigned_to  *string  `json:"assigned_to"`
+		Category     *string  `json:"category"`
+		Department   *string  `json:"department"`
+		Add_tags     []string `json:"add_tags"`
+		Remove_tags  []string `json:"remove_tags"`
+		Comment      *string  `json:"comment"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		macro.Name = *input.Name
+	}
+	if input.Description != nil {
+		macro.Description = *input.Description
+	}
+	if input.Shared != nil {
+		macro.Shared = *input.Shared
+	}
+	if input.Status_val != nil {
+		macro.Status_val = *input.Status_val
+	}
+	if input.Priority_val != nil {
+		macro.Priority_val = *input.Priority_val
+	}
+	if input.Assigned_to != nil {
+		macro.Assigned_to = *input.Assigned_to
+	}
+	if input.Category != nil {
+		macro.Category = *input.Category
+	}
+	if input.Department != nil {
+		macro.Department = *input.Department
+	}
+	if input.Add_tags != nil {
+		macro.Add_tags = input.Add_tags
+	}
+	if input.Remove_tags != nil {
+		macro.Remove_tags = input.Remove_tags
+	}
+	if input.Comment != nil {
+		macro.Comment = *input.Comment
+	}
+	v := validator.New()
+	if data.ValidateMacro(v, macro); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Macros.Update(macro)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateMacro):
+			v.AddError("name", "the owner already has a macro with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"macro": macro}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMacroHandler for the "DELETE /v1/macros/:id" endpoint
+func (app *application) deleteMacroHandler(w http.ResponseWriter, r *http.Request) {
+	macro := app.readOwnMacro(w, r)
+	if macro == nil {
+		return
+	}
+	err := app.models.Macros.Delete(macro.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "macro successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applyMacroHandler for the "POST /v1/coltech_items/:id/macros/:macro_id" endpoint.
+// The field changes, history and comment are saved together or not at all.
+func (app *application) applyMacroHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	macroID, err := app.readInt64Param(r, "macro_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	macro, err := app.models.Macros.Get(macroID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	coltech, err := app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The client may send the version it was looking at so that a macro is
+	// not applied on top of changes it has not seen
+	var input struct {
+		Version *int32 `json:"version"`
+	}
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if input.Version != nil && *input.Version != coltech.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	original := *coltech
+	macro.Apply(coltech)
+	closing := app.markClosed(&original, coltech)
+
+	v := validator.New()
+	err = app.checkPriorityOverride(r, &original, coltech, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.derivePriority(coltech)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	fields, err := app.models.CustomFields.GetAll(coltech.Category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	data.ValidateStatusTransition(v, &original, coltech)
+	if data.ValidateColtech(v, coltech, fields); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The comment is rendered after the changes so placeholders show the new values
+	var comment *data.Comment
+	if macro.Comment != "" {
+		body, err := macro.RenderComment(coltech, user.Name)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		comment = &data.Comment{
+			Coltech_id: coltech.ID,
+			User_id:    user.ID,
+			Author:     user.Name,
+			Body:       body,
+		}
+	}
+	steps, err := app.recategorisedSteps(&original, coltech)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	history := data.DiffColtech(&original, coltech, user.ID, "macro:"+macro.Name)
+	approvals, err := app.models.Coltechs.UpdateWithHistory(coltech, user.ID, history, comment, steps)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if len(approvals) > 0 {
+		app.background(func() {
+			app.sendApprovalRequests(coltech, approvals)
+		})
+	}
+	// Let anyone mentioned in the comment know about it. The macro has been
+	// applied, so a failure here is only logged.
+	unresolved := []string{}
+	if comment != nil {
+		unresolved, err = app.notifyMentions(coltech, user, comment.Body, "", "a comment")
+		if err != nil {
+			app.logError(r, err)
+			unresolved = []string{}
+		}
+	}
+	if closing {
+		app.background(func() {
+			app.sendSurvey(coltech)
+		})
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"coltech": coltech, "comment": comment, "history": history, "unresolved_mentions": unresolved}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"coltech.osborncollins.net/internal/data"
 	"coltech.osborncollins.net/internal/jsonlog"
 	"coltech.osborncollins.net/internal/mailer"
+	"coltech.osborncollins.net/internal/webhook"
 	_ "github.com/lib/pq"
 )
 
@@ -21,9 +22,10 @@ const version = "2.0.0"
 
 // The Configuration Settings
 type config struct {
-	port int
-	env  string // Development, Staging, Production, ETC.
-	db   struct {
+	port      int
+	env       string // Development, Staging, Production, ETC.
+	publicURL string // Where links in emails point to
+	db        struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -44,15 +46,37 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	scheduler struct {
+		enabled  bool
+		interval time.Duration
+	}
+	events struct {
+		retention time.Duration
+	}
+	webhooks struct {
+		enabled  bool
+		interval time.Duration
+		timeout  time.Duration
+	}
+	reminders struct {
+		enabled   bool
+		interval  time.Duration
+		leadTimes leadTimes
+	}
 }
 
 // Dependency Injection
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	mailer   mailer.Mailer
+	wg       sync.WaitGroup
+	events   *eventBroker
+	webhooks webhook.Sender
+	// Closed when the server starts shutting down so that long running
+	// background loops know to stop
+	shutdown chan struct{}
 }
 
 func main() {
@@ -61,6 +85,7 @@ func main() {
 	// Read in flags that are needed to populate our config
 	flag.IntVar(&cfg.port, "port", 4000, "API Server Port") // When using a struct we must use IntVar
 	flag.StringVar(&cfg.env, "env", "development", "Environment( Development | Staging | Production )")
+	flag.StringVar(&cfg.publicURL, "public-url", "http://localhost:4000", "Public base URL used for links in emails")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("COLTECH_DB_DSN"), "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
@@ -82,6 +107,22 @@ func main() {
 		return nil
 	})
 
+	// These are the flags for the recurring coltech item scheduler
+	flag.BoolVar(&cfg.scheduler.enabled, "scheduler-enabled", true, "Create recurring coltech items")
+	flag.DurationVar(&cfg.scheduler.interval, "scheduler-interval", time.Minute, "How often to check for due recurring coltech items")
+	// Flag for how long clients can be away from the event stream and still resume
+	flag.DurationVar(&cfg.events.retention, "events-retention", 72*time.Hour, "How long coltech item events are kept for resuming streams")
+
+	// These are the flags for sending webhook deliveries
+	flag.BoolVar(&cfg.webhooks.enabled, "webhooks-enabled", true, "Send queued webhook deliveries")
+	flag.DurationVar(&cfg.webhooks.interval, "webhooks-interval", 5*time.Second, "How often to check for due webhook deliveries")
+	flag.DurationVar(&cfg.webhooks.timeout, "webhooks-timeout", 10*time.Second, "How long to wait for a webhook receiver to respond")
+	// These are the flags for due date reminder emails
+	flag.BoolVar(&cfg.reminders.enabled, "reminders-enabled", true, "Send due date reminder emails")
+	flag.DurationVar(&cfg.reminders.interval, "reminders-interval", time.Minute, "How often to check for coltech items that need a reminder")
+	cfg.reminders.leadTimes.Set("24h,1h")
+	flag.Var(&cfg.reminders.leadTimes, "reminders-lead-times", "How long before the due date to send reminders (comma separated)")
+
 	flag.Parse()
 
 	//Create a logger
@@ -100,10 +141,13 @@ func main() {
 	//Create an instance of our application struct
 	// We are using the application struct for dependecy injection
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:   cfg,
+		logger:   logger,
+		models:   data.NewModels(db),
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		events:   newEventBroker(),
+		webhooks: webhook.New(cfg.webhooks.timeout),
+		shutdown: make(chan struct{}),
 	}
 	// Call app.serve() to start the server
 	err = app.serve()
@@ -0,0 +1,173 @@
+// Filename: cmd/api/mentions.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// notifyMentions() handles the @mentions in text that were not already in
+// previous: the mentioned users become watchers of the coltech item, get an
+// in-app notification and, unless they turned it off, an email. It returns
+// the mentions that did not match a user, or matched one who may not see the
+// coltech item, so that the client can be told.
+func (app *application) notifyMentions(coltech *data.Coltech, author *data.User, text, previous, where string) ([]string, error) {
+	handles := data.NewMentions(text, previous)
+	if len(handles) == 0 {
+		return []string{}, nil
+	}
+	resolved, unresolved, err := app.models.Users.ResolveMentions(handles)
+	if err != nil {
+		return nil, err
+	}
+	users := []*data.User{}
+	seen := make(map[int64]bool)
+	for _, handle := range handles {
+		user, ok := resolved[handle]
+		if !ok {
+			continue
+		}
+		// Being mentioned makes the user a watcher, which is enough to see
+		// the coltech item unless it is confidential and they are not named
+		// on it. Those users are told nothing about it.
+		if !data.NewViewer(user, nil, nil).CanSee(coltech, true) {
+			unresolved = append(unresolved, handle)
+			continue
+		}
+		if !seen[user.ID] {
+			seen[user.ID] = true
+			users = append(users, user)
+		}
+	}
+	if len(users) == 0 {
+		return unresolved, nil
+	}
+	err = app.models.Notifications.AddMentions(coltech, author, users, where)
+	if err != nil {
+		return nil, err
+	}
+	app.background(func() {
+		app.sendMentionEmails(coltech, author, users, text, where)
+	})
+	return unresolved, nil
+}
+
+// sendMentionEmails() emails the mentioned users who want mention emails. It
+// runs in the background so errors are logged.
+func (app *application) sendMentionEmails(coltech *data.Coltech, author *data.User, users []*data.User, text, where string) {
+	for _, user := range users {
+		if user.ID == author.ID {
+			continue
+		}
+		props := map[string]string{
+			"coltech_id": strconv.FormatInt(coltech.ID, 10),
+			"user_id":    strconv.FormatInt(user.ID, 10),
+		}
+		prefs, err := app.models.Notifications.GetForUser(user.ID)
+		if err != nil {
+			app.logger.PrintError(err, props)
+			continue
+		}
+		if !prefs.Wants(data.NotifyMention) {
+			continue
+		}
+		data := map[string]interface{}{
+			"coltechID": coltech.ID,
+			"key":       coltech.Key,
+			"summary":   coltech.Summary,
+			"author":    author.Name,
+			"where":     where,
+			"text":      text,
+			"name":      user.Name,
+		}
+		err = app.mailer.Send(user.Email, "mention.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, props)
+		}
+	}
+}
+
+// listWatchersHandler for the "GET /v1/coltech_items/:id/watchers" endpoint
+func (app *application) listWatchersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	watchers, err := app.models.Users.GetWatchers(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"watchers": watchers}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listInboxHandler for the "GET /v1/notifications" endpoint. It returns the
+// user's in-app notifications, only the unread ones with ?unread=true.
+func (app *application) listInboxHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	unread := app.readString(qs, "unread", "false")
+	v.Check(validator.In(unread, "true", "false"), "unread", "must be true or false")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The order is fixed, the sort only has to pass validation
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	notifications, metadata, err := app.models.Notifications.GetInbox(app.contextGetUser(r).ID, unread == "true", filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"notifications": notifications, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readNotificationHandler for the "PUT /v1/notifications/:id/read" endpoint
+func (app *application) readNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Other users' notifications are not found rather than forbidden
+	notification, err := app.models.Notifications.MarkRead(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"notification": notification}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,16 +3,19 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"coltech.osborncollins.net/internal/data"
 	"coltech.osborncollins.net/internal/validator"
+	"github.com/julienschmidt/httprouter"
 	"golang.org/x/time/rate"
 )
 
@@ -166,16 +169,13 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 // Check for user permission
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the user
-		user := app.contextGetUser(r)
-		// Get the permission slice for the user
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		// Check the user's permissions
+		ok, err := app.hasPermission(r, code)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
-		// Check for the permission
-		if !permissions.Include(code) {
+		if !ok {
 			app.notPermittedResponse(w, r)
 			return
 		}
@@ -185,6 +185,56 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// resolveColtechKey() lets coltech item routes be addressed by key as well
+// as by id. A key in the :id parameter, current or from before the coltech
+// item moved department, is swapped for the id so that readIDParam() works
+// as before.
+func (app *application) resolveColtechKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		key := params.ByName("id")
+		if !data.ColtechKeyRx.MatchString(key) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := app.models.Coltechs.ResolveKey(key)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		// Copy the params so that the router's slice is left alone
+		resolved := make(httprouter.Params, len(params))
+		for i, param := range params {
+			if param.Key == "id" {
+				param.Value = strconv.FormatInt(id, 10)
+			}
+			resolved[i] = param
+		}
+		ctx := context.WithValue(r.Context(), httprouter.ParamsKey, resolved)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// hasPermission() reports whether the request's user has the permission code.
+// Handlers use it for checks that change what is returned rather than whether
+// the request is allowed at all.
+func (app *application) hasPermission(r *http.Request, code string) (bool, error) {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return false, nil
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include(code), nil
+}
+
 // Enable CORS
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -198,6 +248,9 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 				if origin == app.config.cors.trustedOrigins[i] {
 					// Set the Access-Control-Allow-Origin header
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					// Let scripts read the entity tag they need for If-Match and
+					// whether a create was replayed
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed")
 					break
 				}
 			}
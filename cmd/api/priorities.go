@@ -0,0 +1,90 @@
+// Filename: cmd/api/priorities.go
+
+package main
+
+import (
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// showPriorityMatrixHandler for the "GET /v1/priority_matrix" endpoint
+func (app *application) showPriorityMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	matrix, err := app.models.Priorities.Get()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"matrix": matrix}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePriorityMatrixHandler for the "PUT /v1/priority_matrix" endpoint.
+// The body lists the cells to change, for example
+// {"matrix": [{"impact": "LOW", "urgency": "HIGH", "priority_val": "HIGH"}]},
+// cells that are left out are not changed.
+func (app *application) updatePriorityMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Matrix data.PriorityMatrix `json:"matrix"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidatePriorityMatrix(v, input.Matrix); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Priorities.Set(input.Matrix)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	matrix, err := app.models.Priorities.Get()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"matrix": matrix}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkPriorityOverride() makes sure only agents override the priority of a
+// coltech item and that they say why. An empty priority hands the coltech
+// item back to the matrix.
+func (app *application) checkPriorityOverride(r *http.Request, original, coltech *data.Coltech, v *validator.Validator) error {
+	if coltech.Priority_val == original.Priority_val && coltech.Priority_reason == original.Priority_reason {
+		return nil
+	}
+	ok, err := app.hasPermission(r, "coltech_items:triage")
+	if err != nil {
+		return err
+	}
+	switch {
+	case !ok:
+		v.AddError("priority_val", "can only be set by agents, set impact and urgency instead")
+	case coltech.Priority_val == "":
+		coltech.Priority_reason = ""
+	case coltech.Priority_val != original.Priority_val && coltech.Priority_reason == original.Priority_reason:
+		v.AddError("priority_reason", "must be provided when overriding the priority")
+	}
+	return nil
+}
+
+// derivePriority() sets the coltech item's priority from the matrix unless
+// it has been overridden
+func (app *application) derivePriority(coltech *data.Coltech) error {
+	matrix, err := app.models.Priorities.Get()
+	if err != nil {
+		return err
+	}
+	matrix.Apply(coltech)
+	return nil
+}
@@ -0,0 +1,218 @@
+// Filename: cmd/api/recurrences.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/schedule"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createRecurrenceHandler for the "POST /v1/recurrences" endpoint
+func (app *application) createRecurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Schedule    string `json:"schedule"`
+		Template_id int64  `json:"template_id"`
+		Assigned_to string `json:"assigned_to"`
+		Created_by  string `json:"created_by"`
+		Enabled     *bool  `json:"enabled"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	rec := &data.Recurrence{
+		Name:        input.Name,
+		Schedule:    input.Schedule,
+		Template_id: input.Template_id,
+		Assigned_to: input.Assigned_to,
+		Created_by:  input.Created_by,
+		Enabled:     true,
+	}
+	if input.Enabled != nil {
+		rec.Enabled = *input.Enabled
+	}
+	v := validator.New()
+	err = app.validateRecurrence(v, rec)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Recurrences.Insert(rec)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/recurrences/%d", rec.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recurrence": rec}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listRecurrencesHandler for the "GET /v1/recurrences" endpoint
+func (app *application) listRecurrencesHandler(w http.ResponseWriter, r *http.Request) {
+	recs, err := app.models.Recurrences.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"recurrences": recs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showRecurrenceHandler for the "GET /v1/recurrences/:id" endpoint
+func (app *application) showRecurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	rec, err := app.models.Recurrences.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"recurrence": rec}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateRecurrenceHandler for the "PATCH /v1/recurrences/:id" endpoint
+func (app *application) updateRecurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	rec, err := app.models.Recurrences.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Name        *string `json:"name"`
+		Schedule    *string `json:"schedule"`
+		Template_id *int64  `json:"template_id"`
+		Assigned_to *string `json:"assigned_to"`
+		Created_by  *string `json:"created_by"`
+		Enabled     *bool   `json:"enabled"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		rec.Name = *input.Name
+	}
+	if input.Schedule != nil {
+		rec.Schedule = *input.Schedule
+	}
+	if input.Template_id != nil {
+		rec.Template_id = *input.Template_id
+	}
+	if input.Assigned_to != nil {
+		rec.Assigned_to = *input.Assigned_to
+	}
+	if input.Created_by != nil {
+		rec.Created_by = *input.Created_by
+	}
+	if input.Enabled != nil {
+		rec.Enabled = *input.Enabled
+	}
+	v := validator.New()
+	err = app.validateRecurrence(v, rec)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Recurrences.Update(rec)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"recurrence": rec}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteRecurrenceHandler for the "DELETE /v1/recurrences/:id" endpoint
+func (app *application) deleteRecurrenceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Recurrences.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "recurrence successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateRecurrence() validates the recurrence, checks that its template
+// exists and works out when it should next run
+func (app *application) validateRecurrence(v *validator.Validator, rec *data.Recurrence) error {
+	if data.ValidateRecurrence(v, rec); !v.Valid() {
+		return nil
+	}
+	_, err := app.models.Templates.Get(rec.Template_id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("template_id", "does not exist")
+			return nil
+		default:
+			return err
+		}
+	}
+	// The schedule has already been checked by ValidateRecurrence()
+	sched, _ := schedule.Parse(rec.Schedule)
+	rec.Next_run = sched.Next(time.Now())
+	return nil
+}
@@ -0,0 +1,171 @@
+// Filename: cmd/api/reminders.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+)
+
+// leadTimes is a flag.Value holding how long before the due date reminders
+// are sent, written as a comma separated list of durations such as "24h,1h"
+type leadTimes []time.Duration
+
+func (l *leadTimes) String() string {
+	parts := make([]string, len(*l))
+	for i, lead := range *l {
+		parts[i] = lead.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *leadTimes) Set(value string) error {
+	var leads leadTimes
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lead, err := time.ParseDuration(part)
+		if err != nil {
+			return err
+		}
+		if lead <= 0 {
+			return fmt.Errorf("lead time %s must be positive", part)
+		}
+		leads = append(leads, lead)
+	}
+	// Shortest first so that reminderKind() picks the most urgent reminder
+	sort.Slice(leads, func(i, j int) bool { return leads[i] < leads[j] })
+	*l = leads
+	return nil
+}
+
+// reminderKind() returns the reminder a coltech item due at dueOn should get
+// now: the overdue notice once it is past due, otherwise the reminder for the
+// shortest lead time it is within. It returns false before the longest lead time.
+func reminderKind(dueOn, now time.Time, leads leadTimes) (string, bool) {
+	remaining := dueOn.Sub(now)
+	if remaining <= 0 {
+		return data.ReminderOverdue, true
+	}
+	for _, lead := range leads {
+		if remaining <= lead {
+			return "due_in_" + lead.String(), true
+		}
+	}
+	return "", false
+}
+
+// runReminders() sends due date reminders until the server shuts down
+func (app *application) runReminders() {
+	ticker := time.NewTicker(app.config.reminders.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+			app.sendDueReminders()
+		}
+	}
+}
+
+// sendDueReminders() emails the assignee of every coltech item that has
+// reached a lead time or gone overdue since the last run
+func (app *application) sendDueReminders() {
+	leads := app.config.reminders.leadTimes
+	var horizon time.Duration
+	if len(leads) > 0 {
+		horizon = leads[len(leads)-1]
+	}
+	coltechs, err := app.models.Reminders.GetDue(horizon)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	now := time.Now()
+	for _, coltech := range coltechs {
+		kind, ok := reminderKind(coltech.Due_on, now, leads)
+		if !ok {
+			continue
+		}
+		err = app.sendDueReminder(coltech, kind)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"coltech_id": strconv.FormatInt(coltech.ID, 10),
+				"reminder":   kind,
+			})
+		}
+	}
+}
+
+// sendDueReminder() sends one reminder unless the assignee has turned that
+// kind of email off or another instance has already sent it
+func (app *application) sendDueReminder(coltech *data.Coltech, kind string) error {
+	// Coltech items assigned to someone without an account have nobody to remind
+	user, err := app.models.Users.GetByEmail(coltech.Assigned_to)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+	prefs, err := app.models.Notifications.GetForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	notification := data.NotifyDueReminder
+	template := "due_reminder.tmpl"
+	if kind == data.ReminderOverdue {
+		notification = data.NotifyOverdue
+		template = "overdue_notice.tmpl"
+	}
+	// Claim the reminder even when it is not wanted so that it is not
+	// looked at again every run
+	claimed, err := app.models.Reminders.Claim(coltech.ID, kind, coltech.Due_on)
+	if err != nil || !claimed || !prefs.Wants(notification) {
+		return err
+	}
+	data := map[string]interface{}{
+		"coltechID": coltech.ID,
+		"summary":   coltech.Summary,
+		"dueOn":     coltech.Due_on.Format(time.RFC1123),
+		"dueIn":     humanDuration(time.Until(coltech.Due_on)),
+		"name":      user.Name,
+	}
+	err = app.mailer.Send(user.Email, template, data)
+	if err != nil {
+		// Give the claim back so that the next run tries again
+		if releaseErr := app.models.Reminders.Release(coltech.ID, kind, coltech.Due_on); releaseErr != nil {
+			app.logger.PrintError(releaseErr, map[string]string{
+				"coltech_id": strconv.FormatInt(coltech.ID, 10),
+				"reminder":   kind,
+			})
+		}
+		return err
+	}
+	return nil
+}
+
+// humanDuration() writes a duration the way a person would in an email
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Round(time.Hour)/time.Hour))
+	case d >= time.Hour:
+		return "1 hour"
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%d minutes", int(d.Round(time.Minute)/time.Minute))
+	default:
+		return "1 minute"
+	}
+}
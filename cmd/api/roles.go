@@ -0,0 +1,340 @@
+// Filename: cmd/api/roles.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// listPermissionsHandler for the "GET /v1/permissions" endpoint
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listRolesHandler for the "GET /v1/roles" endpoint
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createRoleHandler for the "POST /v1/roles" endpoint
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	role := &data.Role{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateRole(v, role, known); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Roles.Insert(role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRole):
+			v.AddError("name", "a role with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/roles/%s", role.Name))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"role": role}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showRoleHandler for the "GET /v1/roles/:name" endpoint
+func (app *application) showRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	role, err := app.models.Roles.Get(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"role": role}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAccessUser() returns the user whose access is being managed. It sends
+// the response itself and returns nil when there is no such user.
+func (app *application) readAccessUser(w http.ResponseWriter, r *http.Request) *data.User {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return user
+}
+
+// writeUserAccess() sends the user's roles, the permissions granted to them
+// directly, the effective permissions the two add up to and the departments
+// they work
+func (app *application) writeUserAccess(w http.ResponseWriter, r *http.Request, user *data.User) {
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	direct, err := app.models.Permissions.GetDirectForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	effective, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	departments, err := app.models.Users.GetDepartments(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	access := envelope{
+		"user":                  user,
+		"roles":                 roles,
+		"permissions":           direct,
+		"effective_permissions": effective,
+		"departments":           departments,
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"access": access}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUserAccessHandler for the "GET /v1/user_access/:id" endpoint
+func (app *application) showUserAccessHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readAccessUser(w, r)
+	if user == nil {
+		return
+	}
+	app.writeUserAccess(w, r, user)
+}
+
+// addUserRoleHandler for the "POST /v1/user_access/:id/roles" endpoint
+func (app *application) addUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readAccessUser(w, r)
+	if user == nil {
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Role != "", "role", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Roles.Get(input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("role", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Roles.AddForUser(user.ID, input.Role)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserAccess(w, r, user)
+}
+
+// removeUserRoleHandler for the "DELETE /v1/user_access/:id/roles/:name" endpoint
+func (app *application) removeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readAccessUser(w, r)
+	if user == nil {
+		return
+	}
+	if !app.checkNotSelf(w, r, user) {
+		return
+	}
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	err := app.models.Roles.RemoveForUser(user.ID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeUserAccess(w, r, user)
+}
+
+// addUserPermissionHandler for the "POST /v1/user_access/:id/permissions" endpoint
+func (app *application) addUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readAccessUser(w, r)
+	if user == nil {
+		return
+	}
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(input.Code == "" || known.Include(input.Code), "code", "does not exist")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Permissions.AddForUser(user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserAccess(w, r, user)
+}
+
+// removeUserPermissionHandler for the "DELETE /v1/user_access/:id/permissions/:code"
+// endpoint. It only takes back a direct grant, not one that comes with a role.
+func (app *application) removeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readAccessUser(w, r)
+	if user == nil {
+		return
+	}
+	if !app.checkNotSelf(w, r, user) {
+		return
+	}
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+	err := app.models.Permissions.RemoveForUser(user.ID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeUserAccess(w, r, user)
+}
+
+// updateUserDepartmentsHandler for the "PUT /v1/user_access/:id/departments"
+// endpoint. Users with the coltech_items:read_department permission see the
+// coltech items of the departments they work.
+func (app *application) updateUserDepartmentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.readAccessUser(w, r)
+	if user == nil {
+		return
+	}
+	var input struct {
+		Departments []string `json:"departments"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Departments != nil, "departments", "must be provided")
+	v.Check(len(input.Departments) <= 50, "departments", "must not contain more than 50 departments")
+	v.Check(validator.Unique(input.Departments), "departments", "must not contain duplicate values")
+	for _, department := range input.Departments {
+		v.Check(department != "", "departments", "must not contain empty values")
+		v.Check(len(department) <= 200, "departments", "must not contain values more than 200 bytes long")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Users.SetDepartments(user.ID, input.Departments)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserAccess(w, r, user)
+}
+
+// checkNotSelf() stops admins taking access away from themselves, which
+// could leave nobody able to manage access. It sends the response itself
+// and returns false when the user is the one making the request.
+func (app *application) checkNotSelf(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	if user.ID != app.contextGetUser(r).ID {
+		return true
+	}
+	v := validator.New()
+	v.AddError("id", "you cannot take away your own roles or permissions")
+	app.failedValidationResponse(w, r, v.Errors)
+	return false
+}
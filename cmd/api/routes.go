@@ -15,13 +15,101 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/coltech_items", app.requirePermission("coltech_items:read", app.listCOLTECHItemsHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/coltech_items", app.requirePermission("coltech_items:write", app.createCOLTECHItemHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id", app.requirePermission("coltech_items:read", app.showCOLTECHItemHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/coltech_items/:id", app.requirePermission("coltech_items:write", app.updateCOLTECHItemHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/coltech_items/:id", app.requirePermission("coltech_items:write", app.deleteCOLTECHItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_items", app.requirePermission("coltech_items:create", app.idempotent(app.createCOLTECHItemHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_similar", app.requirePermission("coltech_items:create", app.similarColtechsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.showCOLTECHItemHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/coltech_items/:id", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.updateCOLTECHItemHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/coltech_items/:id", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.deleteCOLTECHItemHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/work_logs", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.listWorkLogsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_items/:id/work_logs", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.idempotent(app.createWorkLogHandler))))
+	router.HandlerFunc(http.MethodPatch, "/v1/coltech_items/:id/work_logs/:log_id", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.updateWorkLogHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/comments", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.listCommentsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_items/:id/comments", app.requirePermission("coltech_items:create", app.resolveColtechKey(app.idempotent(app.createCommentHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/history", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.listHistoryHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_items/:id/macros/:macro_id", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.applyMacroHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/kb_articles", app.requirePermission("kb:read", app.resolveColtechKey(app.listColtechArticlesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_items/:id/kb_articles", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.idempotent(app.linkColtechArticleHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/coltech_items/:id/kb_articles/:article_id", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.unlinkColtechArticleHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/assets", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.listColtechAssetsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/coltech_items/:id/assets", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.idempotent(app.linkColtechAssetHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/coltech_items/:id/assets/:asset_id", app.requirePermission("coltech_items:write", app.resolveColtechKey(app.unlinkColtechAssetHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/approvals", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.listColtechApprovalsHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/coltech_items/:id/watchers", app.requirePermission("coltech_items:read", app.resolveColtechKey(app.listWatchersHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/kb_articles", app.requirePermission("kb:read", app.listArticlesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/kb_articles", app.requirePermission("kb:write", app.idempotent(app.createArticleHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/kb_articles/:id", app.requirePermission("kb:read", app.showArticleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/kb_articles/:id", app.requirePermission("kb:write", app.updateArticleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/kb_articles/:id", app.requirePermission("kb:write", app.deleteArticleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/assets", app.requirePermission("assets:read", app.listAssetsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/assets", app.requirePermission("assets:write", app.idempotent(app.createAssetHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/assets/:id", app.requirePermission("assets:read", app.showAssetHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/assets/:id", app.requirePermission("assets:write", app.updateAssetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/assets/:id", app.requirePermission("assets:write", app.deleteAssetHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/assets/:id/coltech_items", app.requirePermission("assets:read", app.listAssetColtechsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/macros", app.requirePermission("coltech_items:write", app.listMacrosHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/macros", app.requirePermission("coltech_items:write", app.idempotent(app.createMacroHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/macros/:id", app.requirePermission("coltech_items:write", app.showMacroHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/macros/:id", app.requirePermission("coltech_items:write", app.updateMacroHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/macros/:id", app.requirePermission("coltech_items:write", app.deleteMacroHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/events", app.requirePermission("coltech_items:read", app.eventsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requirePermission("admin:access", app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requirePermission("admin:access", app.idempotent(app.createWebhookHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", app.requirePermission("admin:access", app.showWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/webhooks/:id", app.requirePermission("admin:access", app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.requirePermission("admin:access", app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", app.requirePermission("admin:access", app.listWebhookDeliveriesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries/:delivery_id", app.requirePermission("admin:access", app.showWebhookDeliveryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/:id/deliveries/:delivery_id/redeliver", app.requirePermission("admin:access", app.redeliverWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/custom_fields", app.requirePermission("coltech_items:read", app.listCustomFieldsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/custom_fields", app.requirePermission("admin:access", app.idempotent(app.createCustomFieldHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/custom_fields/:id", app.requirePermission("admin:access", app.updateCustomFieldHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/custom_fields/:id", app.requirePermission("admin:access", app.deleteCustomFieldHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/ticket_templates", app.requirePermission("coltech_items:read", app.listTemplatesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/ticket_templates", app.requirePermission("admin:access", app.idempotent(app.createTemplateHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/ticket_templates/:id", app.requirePermission("coltech_items:read", app.showTemplateHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/ticket_templates/:id", app.requirePermission("admin:access", app.updateTemplateHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/ticket_templates/:id", app.requirePermission("admin:access", app.deleteTemplateHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/recurrences", app.requirePermission("admin:access", app.listRecurrencesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/recurrences", app.requirePermission("admin:access", app.idempotent(app.createRecurrenceHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/recurrences/:id", app.requirePermission("admin:access", app.showRecurrenceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/recurrences/:id", app.requirePermission("admin:access", app.updateRecurrenceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/recurrences/:id", app.requirePermission("admin:access", app.deleteRecurrenceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/priority_matrix", app.requirePermission("coltech_items:read", app.showPriorityMatrixHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/priority_matrix", app.requirePermission("admin:access", app.updatePriorityMatrixHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reports/work_time", app.requirePermission("reports:read", app.workTimeReportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reports/satisfaction", app.requirePermission("reports:read", app.satisfactionReportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/approval_steps", app.requirePermission("admin:access", app.listApprovalStepsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/approval_steps", app.requirePermission("admin:access", app.idempotent(app.createApprovalStepHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/approval_steps/:id", app.requirePermission("admin:access", app.deleteApprovalStepHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/approvals/:token", app.showApprovalHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/approvals/:token", app.decideApprovalHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/surveys/:token", app.showSurveyHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/surveys/:token", app.respondSurveyHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/availability", app.requireActivatedUser(app.updateUserAvailabilityHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/notifications", app.requireActivatedUser(app.showNotificationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/notifications", app.requireActivatedUser(app.updateNotificationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/notifications", app.requireActivatedUser(app.listInboxHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/notifications/:id/read", app.requireActivatedUser(app.readNotificationHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/permissions", app.requirePermission("admin:access", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/roles", app.requirePermission("admin:access", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/roles", app.requirePermission("admin:access", app.idempotent(app.createRoleHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/roles/:name", app.requirePermission("admin:access", app.showRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/user_access/:id", app.requirePermission("admin:access", app.showUserAccessHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/user_access/:id/roles", app.requirePermission("admin:access", app.addUserRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/user_access/:id/roles/:name", app.requirePermission("admin:access", app.removeUserRoleHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/user_access/:id/departments", app.requirePermission("admin:access", app.updateUserDepartmentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/user_access/:id/permissions", app.requirePermission("admin:access", app.addUserPermissionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/user_access/:id/permissions/:code", app.requirePermission("admin:access", app.removeUserPermissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/assignment_rules", app.requirePermission("admin:access", app.listAssignmentRulesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/assignment_rules", app.requirePermission("admin:access", app.idempotent(app.createAssignmentRuleHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/assignment_rules/:id", app.requirePermission("admin:access", app.showAssignmentRuleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/assignment_rules/:id", app.requirePermission("admin:access", app.updateAssignmentRuleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/assignment_rules/:id", app.requirePermission("admin:access", app.deleteAssignmentRuleHandler))
 
 	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
 }
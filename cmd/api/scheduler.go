@@ -0,0 +1,119 @@
+// Filename: cmd/api/scheduler.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/schedule"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// runScheduler() checks for due recurring coltech items until the server shuts down
+func (app *application) runScheduler() {
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+			app.createDueRecurrences()
+		}
+	}
+}
+
+// createDueRecurrences() creates a coltech item for every due recurrence.
+// Every instance runs this, the claim in Recurrences.Run() makes sure only
+// one of them creates each occurrence.
+func (app *application) createDueRecurrences() {
+	recs, err := app.models.Recurrences.GetDue()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, rec := range recs {
+		err = app.runRecurrence(rec)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"recurrence_id": strconv.FormatInt(rec.ID, 10),
+			})
+		}
+	}
+}
+
+// runRecurrence() builds the coltech item from the recurrence's template and
+// hands it to the model to create
+func (app *application) runRecurrence(rec *data.Recurrence) error {
+	sched, err := schedule.Parse(rec.Schedule)
+	if err != nil {
+		return err
+	}
+	// Occurrences missed while no instance was running are not backfilled
+	next := sched.Next(time.Now())
+
+	template, err := app.models.Templates.Get(rec.Template_id)
+	if err != nil {
+		return err
+	}
+	coltech := &data.Coltech{
+		Assigned_to: rec.Assigned_to,
+		Created_by:  rec.Created_by,
+	}
+	template.Apply(coltech)
+	err = app.derivePriority(coltech)
+	if err != nil {
+		return err
+	}
+
+	fields, err := app.models.CustomFields.GetAll(coltech.Category)
+	if err != nil {
+		return err
+	}
+	v := validator.New()
+	if data.ValidateColtech(v, coltech, fields); !v.Valid() {
+		// Skip the occurrence rather than retrying a broken template every tick
+		_, err = app.models.Recurrences.Run(rec, nil, nil, next)
+		if err != nil && !errors.Is(err, data.ErrOccurrenceClaimed) {
+			return err
+		}
+		app.logger.PrintError(fmt.Errorf("template %d does not make a valid coltech item", rec.Template_id), v.Errors)
+		return nil
+	}
+	if coltech.Assigned_to == "" {
+		coltech.Assigned_to, err = app.autoAssign(coltech)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Recurring coltech items need the same sign-off as any other
+	steps, err := app.models.Approvals.GetSteps(coltech.Category)
+	if err != nil {
+		return err
+	}
+
+	approvals, err := app.models.Recurrences.Run(rec, coltech, steps, next)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOccurrenceClaimed):
+			return nil
+		default:
+			return err
+		}
+	}
+	if len(approvals) > 0 {
+		app.background(func() {
+			app.sendApprovalRequests(coltech, approvals)
+		})
+	}
+	app.logger.PrintInfo("created recurring coltech item", map[string]string{
+		"recurrence_id": strconv.FormatInt(rec.ID, 10),
+		"coltech_id":    strconv.FormatInt(coltech.ID, 10),
+	})
+	return nil
+}
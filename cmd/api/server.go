@@ -14,6 +14,10 @@ import (
 	"time"
 )
 
+// The longest a handler has to write its response, event streams are kept
+// shorter than this
+const writeTimeout = 30 * time.Second
+
 func (app *application) serve() error {
 	// Create HTTP Server
 	srv := &http.Server{
@@ -22,7 +26,7 @@ func (app *application) serve() error {
 		ErrorLog:     log.New(app.logger, "", 0),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		WriteTimeout: writeTimeout,
 	}
 	// The shutdown() function should return its error to this channel
 	shutdownError := make(chan error)
@@ -39,6 +43,8 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("Shutting down server", map[string]string{
 			"signal": s.String(),
 		})
+		// Tell the background loops to stop
+		close(app.shutdown)
 		// Create a context with a 20 second timeout
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
@@ -56,6 +62,24 @@ func (app *application) serve() error {
 
 	}()
 
+	// Start the scheduler for recurring coltech items
+	if app.config.scheduler.enabled {
+		app.background(app.runScheduler)
+	}
+	// Start passing on events from every instance and removing those that
+	// are too old to resume from
+	app.background(app.runEventListener)
+	app.background(app.runEventPruner)
+	// Start removing idempotency keys that can no longer be replayed
+	app.background(app.runIdempotencyPruner)
+	// Start reminding assignees of coming due dates
+	if app.config.reminders.enabled {
+		app.background(app.runReminders)
+	}
+	// Start sending webhook deliveries
+	if app.config.webhooks.enabled {
+		app.background(app.runWebhookWorker)
+	}
 	// Start our Server
 	app.logger.PrintInfo("Starting Server on", map[string]string{
 		"addr": srv.Addr,
@@ -0,0 +1,161 @@
+// Filename: cmd/api/surveys.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// sendSurvey() emails the requester of a newly closed coltech item a one use
+// link to rate the service. It runs in the background so errors are logged.
+func (app *application) sendSurvey(coltech *data.Coltech) {
+	// Coltech items created before requesters were recorded have nobody to ask
+	if coltech.Requester_id == 0 {
+		return
+	}
+	props := map[string]string{"coltech_id": strconv.FormatInt(coltech.ID, 10)}
+	user, err := app.models.Users.Get(coltech.Requester_id)
+	if err != nil {
+		app.logger.PrintError(err, props)
+		return
+	}
+	token, err := app.models.Tokens.New(user.ID, 7*24*time.Hour, data.ScopeSurvey)
+	if err != nil {
+		app.logger.PrintError(err, props)
+		return
+	}
+	// Keep a copy of who handled the coltech item so that later reassignments
+	// do not move the rating to someone else
+	survey := &data.Survey{
+		Coltech_id:  coltech.ID,
+		User_id:     user.ID,
+		Token_hash:  token.Hash,
+		Assigned_to: coltech.Assigned_to,
+		Department:  coltech.Department,
+	}
+	err = app.models.Surveys.Insert(survey)
+	if err != nil {
+		app.logger.PrintError(err, props)
+		return
+	}
+	data := map[string]interface{}{
+		"coltechID":   coltech.ID,
+		"summary":     coltech.Summary,
+		"surveyToken": token.Plaintext,
+		"surveyURL":   fmt.Sprintf("%s/v1/surveys/%s", app.config.publicURL, token.Plaintext),
+	}
+	err = app.mailer.Send(user.Email, "survey_request.tmpl", data)
+	if err != nil {
+		app.logger.PrintError(err, props)
+	}
+}
+
+// readSurvey() looks up the survey for the token in the URL. It sends the
+// response itself and returns nil when there is no usable survey.
+func (app *application) readSurvey(w http.ResponseWriter, r *http.Request) *data.Survey {
+	tokenPlaintext := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	v := validator.New()
+	if data.ValidateTokenPlainText(v, tokenPlaintext); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	survey, err := app.models.Surveys.GetForToken(tokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired survey token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return survey
+}
+
+// showSurveyHandler for the "GET /v1/surveys/:token" endpoint
+func (app *application) showSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	survey := app.readSurvey(w, r)
+	if survey == nil {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"survey": survey}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// respondSurveyHandler for the "PUT /v1/surveys/:token" endpoint
+func (app *application) respondSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	survey := app.readSurvey(w, r)
+	if survey == nil {
+		return
+	}
+	var input struct {
+		Rating  int    `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	survey.Rating = input.Rating
+	survey.Comment = input.Comment
+
+	v := validator.New()
+	if data.ValidateSurveyResponse(v, survey); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Surveys.Respond(survey)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"survey": survey}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// satisfactionReportHandler for the "GET /v1/reports/satisfaction" endpoint
+func (app *application) satisfactionReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	from := app.readDate(qs, "from", monthStart, v)
+	to := app.readDate(qs, "to", today, v)
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "must be within a year of from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	stats, err := app.models.Surveys.Stats(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"satisfaction": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,212 @@
+// Filename: cmd/api/templates.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createTemplateHandler for the "POST /v1/ticket_templates" endpoint
+func (app *application) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name          string            `json:"name"`
+		Summary       string            `json:"summary"`
+		Description   string            `json:"description"`
+		Category      string            `json:"category"`
+		Department    string            `json:"department"`
+		Priority_val  string            `json:"priority_val"`
+		Tags          []string          `json:"tags"`
+		Custom_fields data.CustomValues `json:"custom_fields"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	template := &data.Template{
+		Name:          input.Name,
+		Summary:       input.Summary,
+		Description:   input.Description,
+		Category:      input.Category,
+		Department:    input.Department,
+		Priority_val:  input.Priority_val,
+		Tags:          input.Tags,
+		Custom_fields: input.Custom_fields,
+	}
+	fields, err := app.models.CustomFields.GetAll(template.Category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTemplate(v, template, fields); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Templates.Insert(template)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTemplate):
+			v.AddError("name", "a template with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/ticket_templates/%d", template.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"ticket_template": template}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTemplatesHandler for the "GET /v1/ticket_templates" endpoint
+func (app *application) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := app.models.Templates.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"ticket_templates": templates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showTemplateHandler for the "GET /v1/ticket_templates/:id" endpoint
+func (app *application) showTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	template, err := app.models.Templates.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"ticket_template": template}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateTemplateHandler for the "PATCH /v1/ticket_templates/:id" endpoint
+func (app *application) updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	template, err := app.models.Templates.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Name          *string           `json:"name"`
+		Summary       *string           `json:"summary"`
+		Description   *string           `json:"description"`
+		Category      *string           `json:"category"`
+		Department    *string           `json:"department"`
+		Priority_val  *string           `json:"priority_val"`
+		Tags          []string          `json:"tags"`
+		Custom_fields data.CustomValues `json:"custom_fields"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		template.Name = *input.Name
+	}
+	if input.Summary != nil {
+		template.Summary = *input.Summary
+	}
+	if input.Description != nil {
+		template.Description = *input.Description
+	}
+	if input.Category != nil {
+		template.Category = *input.Category
+	}
+	if input.Department != nil {
+		template.Department = *input.Department
+	}
+	if input.Priority_val != nil {
+		template.Priority_val = *input.Priority_val
+	}
+	if input.Tags != nil {
+		template.Tags = input.Tags
+	}
+	if input.Custom_fields != nil {
+		template.Custom_fields = input.Custom_fields
+	}
+	fields, err := app.models.CustomFields.GetAll(template.Category)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTemplate(v, template, fields); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Templates.Update(template)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateTemplate):
+			v.AddError("name", "a template with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"ticket_template": template}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTemplateHandler for the "DELETE /v1/ticket_templates/:id" endpoint
+func (app *application) deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Templates.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "ticket template successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
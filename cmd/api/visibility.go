@@ -0,0 +1,68 @@
+// Filename: cmd/api/visibility.go
+
+package main
+
+import (
+	"net/http"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// viewer() works out which coltech items the request's user can see
+func (app *application) viewer(r *http.Request) (*data.Viewer, error) {
+	user := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	departments, err := app.models.Users.GetDepartments(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return data.NewViewer(user, permissions, departments), nil
+}
+
+// getColtech() fetches the coltech item when the request's user can see it,
+// otherwise it is not found
+func (app *application) getColtech(r *http.Request, id int64) (*data.Coltech, error) {
+	viewer, err := app.viewer(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.models.Coltechs.Get(id, viewer)
+}
+
+// checkConfidentialChange() makes sure only agents who triage change who can
+// see a confidential coltech item. Its requester may name more people on it
+// but not take anyone off or lift the confidential flag.
+func (app *application) checkConfidentialChange(r *http.Request, original, coltech *data.Coltech, v *validator.Validator) error {
+	added := true
+	for _, id := range original.Confidential_to {
+		added = added && containsID(coltech.Confidential_to, id)
+	}
+	if coltech.Confidential == original.Confidential && added && len(coltech.Confidential_to) == len(original.Confidential_to) {
+		return nil
+	}
+	ok, err := app.hasPermission(r, "coltech_items:triage")
+	if err != nil || ok {
+		return err
+	}
+	switch {
+	case coltech.Confidential != original.Confidential:
+		v.AddError("confidential", "can only be changed by agents")
+	case !added || coltech.Requester_id != app.contextGetUser(r).ID:
+		v.AddError("confidential_to", "can only have users added, and only by the requester")
+	}
+	return nil
+}
+
+// containsID() reports whether the id is in ids
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+// Filename: cmd/api/webhooks.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+	"coltech.osborncollins.net/internal/webhook"
+)
+
+const (
+	// How many due deliveries the worker takes each time it wakes up
+	webhookBatchSize = 20
+	// Deliveries are marked failed after this many unsuccessful attempts,
+	// which with the backoff covers roughly an hour
+	webhookMaxAttempts = 8
+)
+
+// createWebhookHandler for the "POST /v1/webhooks" endpoint. The secret is
+// generated when none is given and is only ever returned here.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL         string   `json:"url"`
+		Event_types []string `json:"event_types"`
+		Secret      string   `json:"secret"`
+		Enabled     *bool    `json:"enabled"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	hook := &data.Webhook{
+		URL:         input.URL,
+		Event_types: input.Event_types,
+		Secret:      input.Secret,
+		Enabled:     true,
+	}
+	if input.Enabled != nil {
+		hook.Enabled = *input.Enabled
+	}
+	if hook.Event_types == nil {
+		hook.Event_types = []string{}
+	}
+	if hook.Secret == "" {
+		hook.Secret, err = webhook.NewSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	v := validator.New()
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Webhooks.Insert(hook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", hook.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": hook, "secret": hook.Secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhooksHandler for the "GET /v1/webhooks" endpoint
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	hooks, err := app.models.Webhooks.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": hooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWebhookHandler for the "GET /v1/webhooks/:id" endpoint
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": hook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler for the "PATCH /v1/webhooks/:id" endpoint. Sending a
+// new secret rotates it, deliveries already queued are signed with it too.
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		URL         *string  `json:"url"`
+		Event_types []string `json:"event_types"`
+		Secret      *string  `json:"secret"`
+		Enabled     *bool    `json:"enabled"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.URL != nil {
+		hook.URL = *input.URL
+	}
+	if input.Event_types != nil {
+		hook.Event_types = input.Event_types
+	}
+	if input.Secret != nil {
+		hook.Secret = *input.Secret
+	}
+	if input.Enabled != nil {
+		hook.Enabled = *input.Enabled
+	}
+	v := validator.New()
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Webhooks.Update(hook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": hook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler for the "DELETE /v1/webhooks/:id" endpoint
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler for the "GET /v1/webhooks/:id/deliveries" endpoint
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Status string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// Deliveries are always listed newest first
+	input.Filters.Sort = "-id"
+	input.Filters.SortList = []string{"-id"}
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.DeliveryPending, data.DeliveryDelivered, data.DeliveryFailed), "status", "must be pending, delivered or failed")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(hook.ID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWebhookDeliveryHandler for the "GET /v1/webhooks/:id/deliveries/:delivery_id"
+// endpoint. The delivery comes with every attempt made at sending it.
+func (app *application) showWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	deliveryID, err := app.readInt64Param(r, "delivery_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	delivery, err := app.models.Webhooks.GetDelivery(id, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler for the "POST /v1/webhooks/:id/deliveries/:delivery_id/redeliver"
+// endpoint. The delivery is queued again and sent by the next run of the worker.
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	deliveryID, err := app.readInt64Param(r, "delivery_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	delivery, err := app.models.Webhooks.Redeliver(id, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readWebhook() looks up the webhook named in the URL and writes the error
+// response itself when it can't
+func (app *application) readWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	hook, err := app.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return hook, true
+}
+
+// runWebhookWorker() sends due webhook deliveries until the server shuts down
+func (app *application) runWebhookWorker() {
+	ticker := time.NewTicker(app.config.webhooks.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+			app.sendDueWebhooks()
+		}
+	}
+}
+
+// sendDueWebhooks() claims a batch of due deliveries and tries each of them
+// once. The claim lasts long enough for every send in the batch to time out.
+func (app *application) sendDueWebhooks() {
+	lease := time.Duration(webhookBatchSize+1) * app.config.webhooks.timeout
+	deliveries, err := app.models.Webhooks.ClaimDue(webhookBatchSize, lease)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, delivery := range deliveries {
+		start := time.Now()
+		statusCode, sendErr := app.webhooks.Send(context.Background(), webhook.Delivery{
+			ID:        delivery.ID,
+			URL:       delivery.URL,
+			Secret:    delivery.Secret,
+			EventType: delivery.Event_type,
+			Payload:   delivery.Payload,
+		})
+		duration := time.Since(start)
+		next := time.Now().Add(webhook.Backoff(delivery.Attempts + 1))
+		err = app.models.Webhooks.RecordAttempt(delivery, statusCode, sendErr, duration, webhookMaxAttempts, next)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"delivery_id": fmt.Sprint(delivery.ID)})
+			continue
+		}
+		if delivery.Status == data.DeliveryFailed {
+			app.logger.PrintInfo("webhook delivery failed", map[string]string{
+				"delivery_id": fmt.Sprint(delivery.ID),
+				"url":         delivery.URL,
+				"error":       delivery.Last_error,
+			})
+		}
+	}
+}
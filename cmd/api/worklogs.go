@@ -0,0 +1,212 @@
+// Filename: cmd/api/worklogs.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"coltech.osborncollins.net/internal/data"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// createWorkLogHandler for the "POST /v1/coltech_items/:id/work_logs" endpoint
+func (app *application) createWorkLogHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the coltech item exists
+	coltech, err := app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Started_on time.Time `json:"started_on"`
+		Duration   int       `json:"duration_minutes"`
+		Note       string    `json:"note"`
+		Billable   *bool     `json:"billable"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Work is logged against the authenticated user and is billable
+	// unless the client says otherwise
+	log := &data.WorkLog{
+		Coltech_id: coltech.ID,
+		User_id:    app.contextGetUser(r).ID,
+		Started_on: input.Started_on,
+		Duration:   input.Duration,
+		Note:       input.Note,
+		Billable:   true,
+	}
+	if input.Billable != nil {
+		log.Billable = *input.Billable
+	}
+	v := validator.New()
+	if data.ValidateWorkLog(v, log); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.WorkLogs.Insert(log)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/coltech_items/%d/work_logs/%d", coltech.ID, log.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"work_log": log}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWorkLogsHandler for the "GET /v1/coltech_items/:id/work_logs" endpoint
+func (app *application) listWorkLogsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	coltech, err := app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	logs, err := app.models.WorkLogs.GetAllForColtech(coltech.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"work_logs": logs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWorkLogHandler for the "PATCH /v1/coltech_items/:id/work_logs/:log_id" endpoint
+func (app *application) updateWorkLogHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	logID, err := app.readInt64Param(r, "log_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the coltech item exists and the user may still see it
+	_, err = app.getColtech(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	log, err := app.models.WorkLogs.Get(id, logID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Users may only edit the time they logged themselves
+	if log.User_id != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	var input struct {
+		Started_on *time.Time `json:"started_on"`
+		Duration   *int       `json:"duration_minutes"`
+		Note       *string    `json:"note"`
+		Billable   *bool      `json:"billable"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Started_on != nil {
+		log.Started_on = *input.Started_on
+	}
+	if input.Duration != nil {
+		log.Duration = *input.Duration
+	}
+	if input.Note != nil {
+		log.Note = *input.Note
+	}
+	if input.Billable != nil {
+		log.Billable = *input.Billable
+	}
+	v := validator.New()
+	if data.ValidateWorkLog(v, log); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.WorkLogs.Update(log)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"work_log": log}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// workTimeReportHandler for the "GET /v1/reports/work_time" endpoint. The from
+// and to dates are both inclusive and default to the current month so far.
+func (app *application) workTimeReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	from := app.readDate(qs, "from", monthStart, v)
+	to := app.readDate(qs, "to", today, v)
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "must be within a year of from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	report, err := app.models.WorkLogs.Report(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
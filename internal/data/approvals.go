@@ -0,0 +1,423 @@
+// Filename: internal/data/approvals.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The decisions an approver can make, approvals start out pending
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// ApprovalTokenTTL is how long an approver's link works for
+const ApprovalTokenTTL = 14 * 24 * time.Hour
+
+var (
+	ErrDuplicateApprovalStep = errors.New("duplicate approval step")
+)
+
+// An ApprovalStep is a sign-off that every new coltech item in the category
+// needs from the approver before work on it starts
+type ApprovalStep struct {
+	ID          int64     `json:"id"`
+	Created_on  time.Time `json:"created_on"`
+	Category    string    `json:"category"`
+	Name        string    `json:"name"`
+	Approver_id int64     `json:"approver_id"`
+}
+
+func ValidateApprovalStep(v *validator.Validator, step *ApprovalStep) {
+	// Category validation
+	v.Check(step.Category != "", "category", "must be provided")
+	v.Check(len(step.Category) <= 200, "category", "must not be more than 200 bytes long")
+	// Name validation
+	v.Check(step.Name != "", "name", "must be provided")
+	v.Check(len(step.Name) <= 200, "name", "must not be more than 200 bytes long")
+	// Approver validation
+	v.Check(step.Approver_id > 0, "approver_id", "must be provided")
+}
+
+// An Approval is one approver's decision on a coltech item. The plaintext
+// token is only known when the approval is created so it can be emailed.
+type Approval struct {
+	ID          int64      `json:"id"`
+	Created_on  time.Time  `json:"created_on"`
+	Coltech_id  int64      `json:"coltech_id"`
+	Summary     string     `json:"summary,omitempty"`
+	Name        string     `json:"name"`
+	Approver_id int64      `json:"approver_id"`
+	Token       string     `json:"-"`
+	Token_hash  []byte     `json:"-"`
+	Decision    string     `json:"decision"`
+	Comment     string     `json:"comment,omitempty"`
+	Decided_on  *time.Time `json:"decided_on,omitempty"`
+}
+
+func ValidateApprovalDecision(v *validator.Validator, approval *Approval) {
+	v.Check(validator.In(approval.Decision, ApprovalApproved, ApprovalRejected), "decision", "must be approved or rejected")
+	v.Check(approval.Decision != ApprovalRejected || approval.Comment != "", "comment", "must be provided when rejecting")
+	v.Check(len(approval.Comment) <= 1000, "comment", "must not be more than 1000 bytes long")
+}
+
+// ValidateStatusTransition() keeps coltech items awaiting approval where they
+// are until the approvers have decided, and rejected ones rejected so that
+// no work starts on them without sign-off. Only the approval workflow moves a
+// coltech item into or out of AWAITING_APPROVAL.
+func ValidateStatusTransition(v *validator.Validator, original, coltech *Coltech) {
+	if original.Status_val == StatusAwaitingApproval {
+		v.Check(coltech.Status_val == StatusAwaitingApproval, "status_val", "cannot change until all approvals are in")
+		return
+	}
+	if original.Status_val == StatusRejected {
+		v.Check(coltech.Status_val == StatusRejected, "status_val", "cannot change once the approvers have rejected it")
+		return
+	}
+	v.Check(coltech.Status_val != StatusAwaitingApproval, "status_val", "is only set by the approval workflow")
+}
+
+// insertApprovals() asks for every step's approval of a new coltech item as
+// part of its transaction. Each approver gets their own one use token.
+func insertApprovals(ctx context.Context, tx *sql.Tx, coltech *Coltech, steps []*ApprovalStep) ([]*Approval, error) {
+	tokenQuery := `
+		INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)
+	`
+	query := `
+		INSERT INTO approvals (coltech_id, name, approver_id, token_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_on, decision
+	`
+	approvals := make([]*Approval, 0, len(steps))
+	for _, step := range steps {
+		token, err := generateToken(step.Approver_id, ApprovalTokenTTL, ScopeApproval)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, tokenQuery, token.Hash, token.UserID, token.Expiry, token.Scope)
+		if err != nil {
+			return nil, err
+		}
+		approval := &Approval{
+			Coltech_id:  coltech.ID,
+			Summary:     coltech.Summary,
+			Name:        step.Name,
+			Approver_id: step.Approver_id,
+			Token:       token.Plaintext,
+			Token_hash:  token.Hash,
+		}
+		err = tx.QueryRowContext(ctx, query, coltech.ID, step.Name, step.Approver_id, token.Hash).Scan(&approval.ID, &approval.Created_on, &approval.Decision)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, approval)
+	}
+	return approvals, nil
+}
+
+// Define an ApprovalModel which wraps a sql.DB connection pool
+type ApprovalModel struct {
+	DB *sql.DB
+}
+
+// InsertStep() adds an approval step to a category
+func (m ApprovalModel) InsertStep(step *ApprovalStep) error {
+	query := `
+		INSERT INTO approval_steps (category, name, approver_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_on
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, step.Category, step.Name, step.Approver_id).Scan(&step.ID, &step.Created_on)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateApprovalStep
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSteps() returns the approval steps for the category, or for every
+// category when it is empty
+func (m ApprovalModel) GetSteps(category string) ([]*ApprovalStep, error) {
+	query := `
+		SELECT id, created_on, category, name, approver_id
+		FROM approval_steps
+		WHERE (category = $1 OR $1 = '')
+		ORDER BY category, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []*ApprovalStep{}
+	for rows.Next() {
+		var step ApprovalStep
+		err := rows.Scan(&step.ID, &step.Created_on, &step.Category, &step.Name, &step.Approver_id)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, &step)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// DeleteStep() removes an approval step. Coltech items already waiting on
+// it still need its approval.
+func (m ApprovalModel) DeleteStep(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM approval_steps
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForColtech() returns the approvals asked for on a coltech item
+func (m ApprovalModel) GetAllForColtech(coltechID int64) ([]*Approval, error) {
+	query := `
+		SELECT id, created_on, coltech_id, name, approver_id, decision, comment, decided_on
+		FROM approvals
+		WHERE coltech_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, coltechID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []*Approval{}
+	for rows.Next() {
+		var approval Approval
+		err := rows.Scan(
+			&approval.ID,
+			&approval.Created_on,
+			&approval.Coltech_id,
+			&approval.Name,
+			&approval.Approver_id,
+			&approval.Decision,
+			&approval.Comment,
+			&approval.Decided_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, &approval)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// GetForToken() returns the pending approval for an approval scoped token
+// that has not expired, while its coltech item is still awaiting approval
+func (m ApprovalModel) GetForToken(tokenPlaintext string) (*Approval, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		SELECT approvals.id, approvals.created_on, approvals.coltech_id, tblcoltech.summary,
+		approvals.name, approvals.approver_id, approvals.token_hash, approvals.decision
+		FROM approvals
+		INNER JOIN tokens
+		ON approvals.token_hash = tokens.hash
+		INNER JOIN tblcoltech
+		ON approvals.coltech_id = tblcoltech.id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND approvals.decision = $4
+		AND tblcoltech.status_val = $5
+	`
+	args := []interface{}{tokenHash[:], ScopeApproval, time.Now(), ApprovalPending, StatusAwaitingApproval}
+	var approval Approval
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&approval.ID,
+		&approval.Created_on,
+		&approval.Coltech_id,
+		&approval.Summary,
+		&approval.Name,
+		&approval.Approver_id,
+		&approval.Token_hash,
+		&approval.Decision,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &approval, nil
+}
+
+// Decide() records the approver's decision and deletes their token. A
+// rejection moves the coltech item to REJECTED and the last approval moves
+// it to OPEN, with the status change kept in its history and sent as an
+// event. ErrEditConflict is returned when the coltech item is no longer
+// waiting on the approval.
+func (m ApprovalModel) Decide(approval *Approval) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the coltech item so that when the last two approvals come in
+	// together one of them sees the other and opens the coltech item
+	query := `
+		SELECT status_val
+		FROM tblcoltech
+		WHERE id = $1
+		FOR UPDATE
+	`
+	var status string
+	err = tx.QueryRowContext(ctx, query, approval.Coltech_id).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status != StatusAwaitingApproval {
+		return ErrEditConflict
+	}
+	query = `
+		UPDATE approvals
+		SET decision = $2, comment = $3, decided_on = NOW()
+		WHERE id = $1 AND decision = $4
+		RETURNING decided_on
+	`
+	var decidedOn time.Time
+	err = tx.QueryRowContext(ctx, query, approval.ID, approval.Decision, approval.Comment, ApprovalPending).Scan(&decidedOn)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	query = `
+		DELETE FROM tokens
+		WHERE hash = $1
+	`
+	_, err = tx.ExecContext(ctx, query, approval.Token_hash)
+	if err != nil {
+		return err
+	}
+
+	next := StatusRejected
+	if approval.Decision == ApprovalApproved {
+		query = `
+			SELECT COUNT(*)
+			FROM approvals
+			WHERE coltech_id = $1 AND decision <> $2
+		`
+		var outstanding int
+		err = tx.QueryRowContext(ctx, query, approval.Coltech_id, ApprovalApproved).Scan(&outstanding)
+		if err != nil {
+			return err
+		}
+		next = StatusOpen
+		if outstanding > 0 {
+			next = ""
+		}
+	}
+	if next != "" {
+		err = m.moveOn(ctx, tx, approval, next)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	approval.Decided_on = &decidedOn
+	return nil
+}
+
+// moveOn() takes the coltech item out of AWAITING_APPROVAL as part of the
+// decision's transaction
+func (m ApprovalModel) moveOn(ctx context.Context, tx *sql.Tx, approval *Approval, status string) error {
+	query := `
+		UPDATE tblcoltech
+		SET status_val = $2, version = version + 1
+		WHERE id = $1
+	`
+	_, err := tx.ExecContext(ctx, query, approval.Coltech_id, status)
+	if err != nil {
+		return err
+	}
+	sel := selectColtech(nil)
+	query = `
+		SELECT ` + sel.list() + `
+		FROM tblcoltech
+		` + sel.join() + `
+		WHERE id = $1
+	`
+	var coltech Coltech
+	err = tx.QueryRowContext(ctx, query, approval.Coltech_id).Scan(sel.dest(&coltech)...)
+	if err != nil {
+		return err
+	}
+	history := []*HistoryEntry{{
+		Coltech_id: coltech.ID,
+		User_id:    approval.Approver_id,
+		Field:      "status_val",
+		Old_value:  StatusAwaitingApproval,
+		New_value:  status,
+		Source:     "approval:" + approval.Name,
+		Reason:     approval.Comment,
+	}}
+	err = insertHistory(ctx, tx, history)
+	if err != nil {
+		return err
+	}
+	return insertEvent(ctx, tx, &Event{Type: EventUpdated, User_id: approval.Approver_id, Coltech: &coltech})
+}
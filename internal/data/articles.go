@@ -0,0 +1,347 @@
+// Filename: internal/data/articles.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The states a knowledge base article can be in. Only published articles are
+// shown to readers who cannot write articles.
+const (
+	ArticleDraft     = "draft"
+	ArticlePublished = "published"
+)
+
+var (
+	ErrDuplicateLink = errors.New("duplicate article link")
+)
+
+// articleSearchVector must match the expression in kb_articles_search_idx
+// so that the index is used
+const articleSearchVector = `(setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', body), 'B'))`
+
+// An Article is a knowledge base entry describing a known fix. The body is
+// Markdown and is stored and returned as is.
+type Article struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Updated_on time.Time `json:"updated_on"`
+	Title      string    `json:"title"`
+	Body       string    `json:"body"`
+	Category   string    `json:"category"`
+	Status     string    `json:"status"`
+	Created_by string    `json:"created_by"`
+	Version    int32     `json:"version"`
+}
+
+func ValidateArticle(v *validator.Validator, article *Article) {
+	// Title validation
+	v.Check(article.Title != "", "title", "must be provided")
+	v.Check(len(article.Title) <= 300, "title", "must not be more than 300 bytes long")
+	// Body validation
+	v.Check(article.Body != "", "body", "must be provided")
+	v.Check(len(article.Body) <= 100000, "body", "must not be more than 100000 bytes long")
+	// Category validation
+	v.Check(article.Category != "", "category", "must be provided")
+	v.Check(len(article.Category) <= 200, "category", "must not be more than 200 bytes long")
+	// Status validation
+	v.Check(validator.In(article.Status, ArticleDraft, ArticlePublished), "status", "must be draft or published")
+	// Created_by validation
+	v.Check(article.Created_by != "", "created_by", "must be provided")
+	v.Check(len(article.Created_by) <= 300, "created_by", "must not be more than 300 bytes long")
+}
+
+// Define an ArticleModel which wraps a sql.DB connection pool
+type ArticleModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new knowledge base article
+func (m ArticleModel) Insert(article *Article) error {
+	query := `
+		INSERT INTO kb_articles (title, body, category, status, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_on, updated_on, version
+	`
+	args := []interface{}{
+		article.Title,
+		article.Body,
+		article.Category,
+		article.Status,
+		article.Created_by,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&article.ID, &article.Created_on, &article.Updated_on, &article.Version)
+}
+
+// Get() allows us to retrieve a specific knowledge base article
+func (m ArticleModel) Get(id int64) (*Article, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, updated_on, title, body, category, status, created_by, version
+		FROM kb_articles
+		WHERE id = $1
+	`
+	var article Article
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&article.ID,
+		&article.Created_on,
+		&article.Updated_on,
+		&article.Title,
+		&article.Body,
+		&article.Category,
+		&article.Status,
+		&article.Created_by,
+		&article.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &article, nil
+}
+
+// GetAll() returns the articles matching the search text, category and status.
+// When searching with the default sort the best matches come first.
+func (m ArticleModel) GetAll(search string, category string, status string, filters Filters) ([]*Article, Metadata, error) {
+	order := fmt.Sprintf("%s %s", filters.sortColumn(), filters.sortOrder())
+	if search != "" && filters.Sort == "id" {
+		order = "ts_rank(" + articleSearchVector + ", plainto_tsquery('english', $1)) DESC"
+	}
+	query := `
+		SELECT COUNT(*) OVER(), id, created_on, updated_on, title, body, category, status, created_by, version
+		FROM kb_articles
+		WHERE (` + articleSearchVector + ` @@ plainto_tsquery('english', $1) OR $1 = '')
+		AND (category = $2 OR $2 = '')
+		AND (status = $3 OR $3 = '')
+		ORDER BY ` + order + `, id ASC
+		LIMIT $4 OFFSET $5`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []interface{}{search, category, status, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	articles := []*Article{}
+	for rows.Next() {
+		var article Article
+		err := rows.Scan(
+			&totalRecords,
+			&article.ID,
+			&article.Created_on,
+			&article.Updated_on,
+			&article.Title,
+			&article.Body,
+			&article.Category,
+			&article.Status,
+			&article.Created_by,
+			&article.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		articles = append(articles, &article)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return articles, metadata, nil
+}
+
+// Update() allows us to edit a knowledge base article
+func (m ArticleModel) Update(article *Article) error {
+	query := `
+		UPDATE kb_articles
+		SET title = $2, body = $3, category = $4, status = $5, created_by = $6,
+		updated_on = NOW(), version = version + 1
+		WHERE id = $1
+		AND version = $7
+		RETURNING updated_on, version
+	`
+	args := []interface{}{
+		article.ID,
+		article.Title,
+		article.Body,
+		article.Category,
+		article.Status,
+		article.Created_by,
+		article.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&article.Updated_on, &article.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific knowledge base article and its links
+func (m ArticleModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM kb_articles
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Link() records that an article helped with a coltech item
+func (m ArticleModel) Link(articleID, coltechID int64) error {
+	query := `
+		INSERT INTO kb_article_links (article_id, coltech_id)
+		VALUES ($1, $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, articleID, coltechID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateLink
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlink() removes the link between an article and a coltech item
+func (m ArticleModel) Unlink(articleID, coltechID int64) error {
+	query := `
+		DELETE FROM kb_article_links
+		WHERE article_id = $1 AND coltech_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, articleID, coltechID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForColtech() returns the articles linked to a coltech item. Drafts are
+// left out unless includeDrafts is set.
+func (m ArticleModel) GetAllForColtech(coltechID int64, includeDrafts bool) ([]*Article, error) {
+	query := `
+		SELECT kb_articles.id, kb_articles.created_on, kb_articles.updated_on, title, body,
+		category, status, created_by, version
+		FROM kb_articles
+		INNER JOIN kb_article_links
+		ON kb_article_links.article_id = kb_articles.id
+		WHERE kb_article_links.coltech_id = $1
+		AND (status = $2 OR $3)
+		ORDER BY kb_article_links.created_on, kb_articles.id
+	`
+	return m.query(query, coltechID, ArticlePublished, includeDrafts)
+}
+
+// Suggest() returns the published articles that best match the text, such as
+// a new coltech item's summary. Any word matching is enough to be suggested.
+func (m ArticleModel) Suggest(text string, limit int) ([]*Article, error) {
+	// plainto_tsquery() joins the words with & so swap them for | to match any word
+	query := `
+		WITH q AS (
+			SELECT NULLIF(replace(plainto_tsquery('english', $1)::text, '&', '|'), '')::tsquery AS query
+		)
+		SELECT id, created_on, updated_on, title, body, category, status, created_by, version
+		FROM kb_articles, q
+		WHERE status = $2
+		AND ` + articleSearchVector + ` @@ q.query
+		ORDER BY ts_rank(` + articleSearchVector + `, q.query) DESC, id ASC
+		LIMIT $3
+	`
+	return m.query(query, text, ArticlePublished, limit)
+}
+
+// query() runs an article listing query
+func (m ArticleModel) query(query string, args ...interface{}) ([]*Article, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := []*Article{}
+	for rows.Next() {
+		var article Article
+		err := rows.Scan(
+			&article.ID,
+			&article.Created_on,
+			&article.Updated_on,
+			&article.Title,
+			&article.Body,
+			&article.Category,
+			&article.Status,
+			&article.Created_by,
+			&article.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, &article)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
@@ -0,0 +1,379 @@
+// Filename: internal/data/assets.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The states an asset can be in
+const (
+	AssetInStock  = "in_stock"
+	AssetInUse    = "in_use"
+	AssetInRepair = "in_repair"
+	AssetRetired  = "retired"
+)
+
+// AssetStatuses lists every state an asset can be in
+var AssetStatuses = []string{AssetInStock, AssetInUse, AssetInRepair, AssetRetired}
+
+var (
+	ErrDuplicateAssetTag  = errors.New("duplicate asset tag")
+	ErrDuplicateAssetLink = errors.New("duplicate asset link")
+)
+
+// An Asset is a piece of equipment coltech items can be about, such as a
+// laptop, projector or switch. Ticket_count is how many coltech items have
+// been linked to it.
+type Asset struct {
+	ID           int64     `json:"id"`
+	Created_on   time.Time `json:"created_on"`
+	Updated_on   time.Time `json:"updated_on"`
+	Asset_tag    string    `json:"asset_tag"`
+	Type         string    `json:"type"`
+	Model        string    `json:"model"`
+	Serial       string    `json:"serial"`
+	Location     string    `json:"location"`
+	Owner_id     int64     `json:"owner_id"`
+	Status       string    `json:"status"`
+	Warranty_end time.Time `json:"warranty_end"`
+	Ticket_count int64     `json:"ticket_count"`
+	Version      int32     `json:"version"`
+}
+
+func ValidateAsset(v *validator.Validator, asset *Asset) {
+	// Asset tag validation
+	v.Check(asset.Asset_tag != "", "asset_tag", "must be provided")
+	v.Check(len(asset.Asset_tag) <= 50, "asset_tag", "must not be more than 50 bytes long")
+	// Type validation
+	v.Check(asset.Type != "", "type", "must be provided")
+	v.Check(len(asset.Type) <= 100, "type", "must not be more than 100 bytes long")
+	// Model, serial and location validation
+	v.Check(len(asset.Model) <= 200, "model", "must not be more than 200 bytes long")
+	v.Check(len(asset.Serial) <= 200, "serial", "must not be more than 200 bytes long")
+	v.Check(len(asset.Location) <= 200, "location", "must not be more than 200 bytes long")
+	// Owner validation
+	v.Check(asset.Owner_id >= 0, "owner_id", "must not be negative")
+	// Status validation
+	v.Check(validator.In(asset.Status, AssetStatuses...), "status", "must be in_stock, in_use, in_repair or retired")
+}
+
+// assetColumns selects an asset in the order assetDest() scans it
+const assetColumns = `assets.id, assets.created_on, updated_on, asset_tag, type, model, serial,
+	location, COALESCE(owner_id, 0), status, warranty_end,
+	(SELECT COUNT(*) FROM asset_links WHERE asset_links.asset_id = assets.id) AS ticket_count,
+	version`
+
+// assetDest() returns the scan destinations for assetColumns
+func assetDest(asset *Asset) []interface{} {
+	return []interface{}{
+		&asset.ID,
+		&asset.Created_on,
+		&asset.Updated_on,
+		&asset.Asset_tag,
+		&asset.Type,
+		&asset.Model,
+		&asset.Serial,
+		&asset.Location,
+		&asset.Owner_id,
+		&asset.Status,
+		&asset.Warranty_end,
+		&asset.Ticket_count,
+		&asset.Version,
+	}
+}
+
+// Define an AssetModel which wraps a sql.DB connection pool
+type AssetModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to add an asset to the inventory
+func (m AssetModel) Insert(asset *Asset) error {
+	query := `
+		INSERT INTO assets (asset_tag, type, model, serial, location, owner_id, status, warranty_end)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8)
+		RETURNING id, created_on, updated_on, version
+	`
+	args := []interface{}{
+		asset.Asset_tag,
+		asset.Type,
+		asset.Model,
+		asset.Serial,
+		asset.Location,
+		asset.Owner_id,
+		asset.Status,
+		asset.Warranty_end,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&asset.ID, &asset.Created_on, &asset.Updated_on, &asset.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateAssetTag
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific asset
+func (m AssetModel) Get(id int64) (*Asset, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		WHERE id = $1
+	`
+	var asset Asset
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(assetDest(&asset)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &asset, nil
+}
+
+// GetAll() returns the assets matching the filters. The search text is
+// looked for in the asset tag, model and serial number.
+func (m AssetModel) GetAll(search string, assetType string, status string, location string, ownerID int64, filters Filters) ([]*Asset, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), `+assetColumns+`
+		FROM assets
+		WHERE ($1 = '' OR asset_tag ILIKE '%%' || $1 || '%%' OR model ILIKE '%%' || $1 || '%%' OR serial ILIKE '%%' || $1 || '%%')
+		AND (type = $2 OR $2 = '')
+		AND (status = $3 OR $3 = '')
+		AND (location = $4 OR $4 = '')
+		AND (owner_id = $5 OR $5 = 0)
+		ORDER BY %s %s, id ASC
+		LIMIT $6 OFFSET $7`, filters.sortColumn(), filters.sortOrder())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	args := []interface{}{search, assetType, status, location, ownerID, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	assets := []*Asset{}
+	for rows.Next() {
+		var asset Asset
+		err := rows.Scan(append([]interface{}{&totalRecords}, assetDest(&asset)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		assets = append(assets, &asset)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return assets, metadata, nil
+}
+
+// Update() allows us to edit an asset
+func (m AssetModel) Update(asset *Asset) error {
+	query := `
+		UPDATE assets
+		SET asset_tag = $2, type = $3, model = $4, serial = $5, location = $6,
+		owner_id = NULLIF($7, 0), status = $8, warranty_end = $9,
+		updated_on = NOW(), version = version + 1
+		WHERE id = $1
+		AND version = $10
+		RETURNING updated_on, version
+	`
+	args := []interface{}{
+		asset.ID,
+		asset.Asset_tag,
+		asset.Type,
+		asset.Model,
+		asset.Serial,
+		asset.Location,
+		asset.Owner_id,
+		asset.Status,
+		asset.Warranty_end,
+		asset.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&asset.Updated_on, &asset.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case isUniqueViolation(err):
+			return ErrDuplicateAssetTag
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific asset and its links
+func (m AssetModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM assets
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Link() records that a coltech item is about an asset
+func (m AssetModel) Link(assetID, coltechID int64) error {
+	query := `
+		INSERT INTO asset_links (asset_id, coltech_id)
+		VALUES ($1, $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, assetID, coltechID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateAssetLink
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlink() removes the link between an asset and a coltech item
+func (m AssetModel) Unlink(assetID, coltechID int64) error {
+	query := `
+		DELETE FROM asset_links
+		WHERE asset_id = $1 AND coltech_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, assetID, coltechID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForColtech() returns the assets linked to a coltech item
+func (m AssetModel) GetAllForColtech(coltechID int64) ([]*Asset, error) {
+	query := `
+		SELECT ` + assetColumns + `
+		FROM assets
+		INNER JOIN asset_links
+		ON asset_links.asset_id = assets.id
+		WHERE asset_links.coltech_id = $1
+		ORDER BY asset_links.created_on, assets.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, coltechID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []*Asset{}
+	for rows.Next() {
+		var asset Asset
+		err := rows.Scan(assetDest(&asset)...)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, &asset)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// GetColtechs() returns the coltech items linked to an asset, most recently
+// opened first, so that equipment that keeps breaking stands out. Only the
+// ones the viewer can see are returned.
+func (m AssetModel) GetColtechs(assetID int64, filters Filters, viewer *Viewer) ([]*Coltech, Metadata, error) {
+	sel := selectColtech(nil)
+	visible, args := viewer.clause(4)
+	query := `
+		SELECT COUNT(*) OVER(), ` + sel.list() + `
+		FROM tblcoltech
+		` + sel.join() + `
+		WHERE id IN (SELECT coltech_id FROM asset_links WHERE asset_id = $1)
+		AND ` + visible + `
+		ORDER BY created_on DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args = append([]interface{}{assetID, filters.limit(), filters.offset()}, args...)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	coltechs := []*Coltech{}
+	for rows.Next() {
+		var coltech Coltech
+		err := rows.Scan(append([]interface{}{&totalRecords}, sel.dest(&coltech)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		coltechs = append(coltechs, &coltech)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return coltechs, metadata, nil
+}
@@ -0,0 +1,400 @@
+// Filename: internal/data/assignments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// The assignee value given to tickets that no one has picked up yet
+const Unassigned = "UNASSIGNED"
+
+// Assignment strategies
+const (
+	StrategyRoundRobin = "round_robin"
+	StrategyLeastOpen  = "least_open"
+	StrategyFixed      = "fixed"
+)
+
+var (
+	ErrDuplicateRule       = errors.New("duplicate assignment rule")
+	ErrNoAvailableAssignee = errors.New("no available assignee")
+)
+
+// An AssignmentRule decides who new tickets for a department (and
+// optionally a single category in that department) are given to
+type AssignmentRule struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Department string    `json:"department"`
+	Category   string    `json:"category"`
+	Strategy   string    `json:"strategy"`
+	User_ids   []int64   `json:"user_ids"`
+	Version    int32     `json:"version"`
+}
+
+func ValidateAssignmentRule(v *validator.Validator, rule *AssignmentRule) {
+	// Department validation
+	v.Check(rule.Department != "", "department", "must be provided")
+	v.Check(len(rule.Department) <= 200, "department", "must not be more than 200 bytes long")
+	// Category is optional, an empty category matches the whole department
+	v.Check(len(rule.Category) <= 200, "category", "must not be more than 200 bytes long")
+	// Strategy validation
+	v.Check(validator.In(rule.Strategy, StrategyRoundRobin, StrategyLeastOpen, StrategyFixed), "strategy", "must be round_robin, least_open or fixed")
+	// The pool of users validation
+	v.Check(len(rule.User_ids) > 0, "user_ids", "must contain at least one user")
+	v.Check(len(rule.User_ids) <= 100, "user_ids", "must not contain more than 100 users")
+	ids := make([]string, len(rule.User_ids))
+	for i, id := range rule.User_ids {
+		v.Check(id > 0, "user_ids", "must only contain valid user ids")
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	v.Check(validator.Unique(ids), "user_ids", "must not contain duplicate values")
+}
+
+// Define an AssignmentRuleModel which wraps a sql.DB connection pool
+type AssignmentRuleModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new assignment rule
+func (m AssignmentRuleModel) Insert(rule *AssignmentRule) error {
+	query := `
+		INSERT INTO assignment_rules (department, category, strategy, user_ids)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{rule.Department, rule.Category, rule.Strategy, pq.Array(rule.User_ids)}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&rule.ID, &rule.Created_on, &rule.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateRule
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific assignment rule
+func (m AssignmentRuleModel) Get(id int64) (*AssignmentRule, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, department, category, strategy, user_ids, version
+		FROM assignment_rules
+		WHERE id = $1
+	`
+	var rule AssignmentRule
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&rule.ID,
+		&rule.Created_on,
+		&rule.Department,
+		&rule.Category,
+		&rule.Strategy,
+		pq.Array(&rule.User_ids),
+		&rule.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rule, nil
+}
+
+// GetAll() returns every assignment rule sorted by department then category
+func (m AssignmentRuleModel) GetAll() ([]*AssignmentRule, error) {
+	query := `
+		SELECT id, created_on, department, category, strategy, user_ids, version
+		FROM assignment_rules
+		ORDER BY department, category, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*AssignmentRule{}
+	for rows.Next() {
+		var rule AssignmentRule
+		err := rows.Scan(
+			&rule.ID,
+			&rule.Created_on,
+			&rule.Department,
+			&rule.Category,
+			&rule.Strategy,
+			pq.Array(&rule.User_ids),
+			&rule.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Update() allows us to edit an assignment rule
+func (m AssignmentRuleModel) Update(rule *AssignmentRule) error {
+	query := `
+		UPDATE assignment_rules
+		SET department = $2, category = $3, strategy = $4, user_ids = $5,
+		version = version + 1
+		WHERE id = $1
+		AND version = $6
+		RETURNING version
+	`
+	args := []interface{}{
+		rule.ID,
+		rule.Department,
+		rule.Category,
+		rule.Strategy,
+		pq.Array(rule.User_ids),
+		rule.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&rule.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case isUniqueViolation(err):
+			return ErrDuplicateRule
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific assignment rule
+func (m AssignmentRuleModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM assignment_rules
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Match() returns the rule for a department and category. A rule for the
+// exact category wins over the department wide rule.
+func (m AssignmentRuleModel) Match(department, category string) (*AssignmentRule, error) {
+	query := `
+		SELECT id, created_on, department, category, strategy, user_ids, version
+		FROM assignment_rules
+		WHERE department = $1
+		AND (category = $2 OR category = '')
+		ORDER BY category DESC
+		LIMIT 1
+	`
+	var rule AssignmentRule
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, department, category).Scan(
+		&rule.ID,
+		&rule.Created_on,
+		&rule.Department,
+		&rule.Category,
+		&rule.Strategy,
+		pq.Array(&rule.User_ids),
+		&rule.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rule, nil
+}
+
+// PickAssignee() applies the rule's strategy to its pool of users. Users that
+// are unavailable or not activated are skipped.
+func (m AssignmentRuleModel) PickAssignee(rule *AssignmentRule) (*User, error) {
+	switch rule.Strategy {
+	case StrategyRoundRobin:
+		return m.pickRoundRobin(rule.ID)
+	case StrategyLeastOpen:
+		return m.pickLeastOpen(rule.User_ids)
+	default:
+		return m.pickFixed(rule.User_ids)
+	}
+}
+
+// pickFixed() returns the first available user in the pool, so the owner
+// is always chosen unless they are away
+func (m AssignmentRuleModel) pickFixed(userIDs []int64) (*User, error) {
+	query := `
+		SELECT id, created_on, name, email, activated, available, version
+		FROM tblusers
+		WHERE id = ANY($1) AND activated AND available
+		ORDER BY array_position($1, id)
+		LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanAssignee(m.DB.QueryRowContext(ctx, query, pq.Array(userIDs)))
+}
+
+// pickLeastOpen() returns the available user with the fewest tickets that
+// are not closed, ties go to whoever is earlier in the pool
+func (m AssignmentRuleModel) pickLeastOpen(userIDs []int64) (*User, error) {
+	query := `
+		SELECT u.id, u.created_on, u.name, u.email, u.activated, u.available, u.version
+		FROM tblusers u
+		LEFT JOIN tblcoltech c
+		ON c.assigned_to = u.email AND c.status_val <> 'CLOSED'
+		WHERE u.id = ANY($1) AND u.activated AND u.available
+		GROUP BY u.id
+		ORDER BY COUNT(c.id), array_position($1, u.id)
+		LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanAssignee(m.DB.QueryRowContext(ctx, query, pq.Array(userIDs)))
+}
+
+// pickRoundRobin() moves the rule's cursor on to the next available user.
+// The rule row is locked so concurrent creates don't pick the same user.
+func (m AssignmentRuleModel) pickRoundRobin(ruleID int64) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userIDs []int64
+	var lastAssigned int64
+	query := `
+		SELECT user_ids, last_assigned_id
+		FROM assignment_rules
+		WHERE id = $1
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, query, ruleID).Scan(pq.Array(&userIDs), &lastAssigned)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	// Rotate the pool so that it starts just after the last assignee
+	start := 0
+	for i, id := range userIDs {
+		if id == lastAssigned {
+			start = i + 1
+			break
+		}
+	}
+	rotated := append(append([]int64{}, userIDs[start:]...), userIDs[:start]...)
+
+	query = `
+		SELECT id, created_on, name, email, activated, available, version
+		FROM tblusers
+		WHERE id = ANY($1) AND activated AND available
+		ORDER BY array_position($1, id)
+		LIMIT 1
+	`
+	user, err := scanAssignee(tx.QueryRowContext(ctx, query, pq.Array(rotated)))
+	if err != nil {
+		return nil, err
+	}
+	// Save the cursor
+	query = `
+		UPDATE assignment_rules
+		SET last_assigned_id = $2
+		WHERE id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, ruleID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// scanAssignee() reads a candidate user from a single row result
+func scanAssignee(row *sql.Row) (*User, error) {
+	var user User
+	err := row.Scan(
+		&user.ID,
+		&user.Created_on,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Available,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoAvailableAssignee
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// isUniqueViolation() checks for the postgres unique_violation error code
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -7,28 +7,51 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// The statuses the API itself moves coltech items between. Coltech items
+// start out OPEN, wait in AWAITING_APPROVAL when their category needs
+// approval and are finished when CLOSED.
+const (
+	StatusOpen             = "OPEN"
+	StatusAwaitingApproval = "AWAITING_APPROVAL"
+	StatusRejected         = "REJECTED"
+	StatusClosed           = "CLOSED"
 )
 
 type Coltech struct {
-	ID           int64     `json:"id"`
-	Created_on   time.Time `json:"created_on"`
-	Summary      string    `json:"summary"`
-	Description  string    `json:"desription"`
-	Priority_val string    `json:"priority_val"`
-	Status_val   string    `json:"status_val"`
-	Assigned_to  string    `json:"assigned_to"`
-	Category     string    `json:"category"`
-	Department   string    `json:"department"`
-	Closed_on    time.Time `json:"closed_on"`
-	Created_by   string    `json:"created_by"`
-	Due_on       time.Time `json:"due_on"`
-	Version      int32     `json:"version"`
+	ID              int64        `json:"id"`
+	Key             string       `json:"key"`
+	Created_on      time.Time    `json:"created_on"`
+	Summary         string       `json:"summary"`
+	Description     string       `json:"description"`
+	Priority_val    string       `json:"priority_val"`
+	Priority_reason string       `json:"priority_reason"`
+	Impact          string       `json:"impact"`
+	Urgency         string       `json:"urgency"`
+	Status_val      string       `json:"status_val"`
+	Assigned_to     string       `json:"assigned_to"`
+	Category        string       `json:"category"`
+	Department      string       `json:"department"`
+	Closed_on       time.Time    `json:"closed_on"`
+	Created_by      string       `json:"created_by"`
+	Requester_id    int64        `json:"requester_id"`
+	Due_on          time.Time    `json:"due_on"`
+	Custom_fields   CustomValues `json:"custom_fields"`
+	Tags            []string     `json:"tags"`
+	Confidential    bool         `json:"confidential"`
+	Confidential_to []int64      `json:"confidential_to"`
+	Time_spent      int64        `json:"time_spent_minutes"`
+	Billable_time   int64        `json:"billable_minutes"`
+	Version         int32        `json:"version"`
 }
 
-func ValidateColtech(v *validator.Validator, coltech *Coltech) {
+func ValidateColtech(v *validator.Validator, coltech *Coltech, fields []*CustomField) {
 
 	// Use the check() method to execute our validation checks
 	// Summary validation
@@ -47,10 +70,149 @@ func ValidateColtech(v *validator.Validator, coltech *Coltech) {
 	v.Check(coltech.Department != "", "department", "must be provided")
 	v.Check(len(coltech.Department) <= 200, "department", "must not be more than 200 bytes long")
 
+	// Impact and urgency validation
+	v.Check(validator.In(coltech.Impact, Levels...), "impact", "must be HIGH, MEDIUM or LOW")
+	v.Check(validator.In(coltech.Urgency, Levels...), "urgency", "must be HIGH, MEDIUM or LOW")
+
+	// Priority validation, an overridden priority must be given
+	v.Check(coltech.Priority_reason == "" || coltech.Priority_val != "", "priority_val", "must be provided with a priority_reason")
+	v.Check(len(coltech.Priority_val) <= 50, "priority_val", "must not be more than 50 bytes long")
+	v.Check(len(coltech.Priority_reason) <= 500, "priority_reason", "must not be more than 500 bytes long")
+
 	// Created_by validation
 	v.Check(coltech.Created_by != "", "created_by", "must be provided")
 	v.Check(len(coltech.Created_by) <= 300, "created_by", "must not be more than 300 bytes long")
 
+	// Custom field validation using the definitions for the coltech's category
+	ValidateCustomValues(v, coltech.Custom_fields, fields)
+
+	// Tags validation
+	v.Check(len(coltech.Tags) <= 20, "tags", "must not contain more than 20 tags")
+	v.Check(validator.Unique(coltech.Tags), "tags", "must not contain duplicate values")
+	for _, tag := range coltech.Tags {
+		v.Check(tag != "", "tags", "must not contain empty values")
+		v.Check(len(tag) <= 50, "tags", "must not contain values more than 50 bytes long")
+	}
+
+	// Confidential_to validation, the users named on a confidential coltech item
+	v.Check(len(coltech.Confidential_to) <= 50, "confidential_to", "must not contain more than 50 users")
+	v.Check(uniqueIDs(coltech.Confidential_to), "confidential_to", "must not contain duplicate values")
+	for _, id := range coltech.Confidential_to {
+		v.Check(id > 0, "confidential_to", "must only contain user ids")
+	}
+
+}
+
+// workTotalsQuery sums the work logged against the current tblcoltech row
+const workTotalsQuery = `
+	SELECT SUM(duration_minutes) AS minutes,
+	SUM(duration_minutes) FILTER (WHERE billable) AS billable
+	FROM work_logs
+	WHERE work_logs.coltech_id = tblcoltech.id`
+
+// coltechColumn ties a field of the Coltech JSON to the SQL that selects it
+// and the struct field it is scanned into
+type coltechColumn struct {
+	field string
+	expr  string
+	dest  func(coltech *Coltech) interface{}
+}
+
+// coltechColumns are the columns Get() and GetAll() can select, in order
+var coltechColumns = []coltechColumn{
+	{"id", "id", func(c *Coltech) interface{} { return &c.ID }},
+	{"key", "key", func(c *Coltech) interface{} { return &c.Key }},
+	{"created_on", "created_on", func(c *Coltech) interface{} { return &c.Created_on }},
+	{"summary", "summary", func(c *Coltech) interface{} { return &c.Summary }},
+	{"description", "description", func(c *Coltech) interface{} { return &c.Description }},
+	{"priority_val", "priority_val", func(c *Coltech) interface{} { return &c.Priority_val }},
+	{"priority_reason", "priority_reason", func(c *Coltech) interface{} { return &c.Priority_reason }},
+	{"impact", "impact", func(c *Coltech) interface{} { return &c.Impact }},
+	{"urgency", "urgency", func(c *Coltech) interface{} { return &c.Urgency }},
+	{"status_val", "status_val", func(c *Coltech) interface{} { return &c.Status_val }},
+	{"assigned_to", "assigned_to", func(c *Coltech) interface{} { return &c.Assigned_to }},
+	{"category", "category", func(c *Coltech) interface{} { return &c.Category }},
+	{"department", "department", func(c *Coltech) interface{} { return &c.Department }},
+	{"closed_on", "closed_on", func(c *Coltech) interface{} { return &c.Closed_on }},
+	{"created_by", "created_by", func(c *Coltech) interface{} { return &c.Created_by }},
+	{"requester_id", "COALESCE(requester_id, 0)", func(c *Coltech) interface{} { return &c.Requester_id }},
+	{"due_on", "due_on", func(c *Coltech) interface{} { return &c.Due_on }},
+	{"custom_fields", "custom_fields", func(c *Coltech) interface{} { return &c.Custom_fields }},
+	{"tags", "tags", func(c *Coltech) interface{} { return pq.Array(&c.Tags) }},
+	{"confidential", "confidential", func(c *Coltech) interface{} { return &c.Confidential }},
+	{"confidential_to", "confidential_to", func(c *Coltech) interface{} { return pq.Array(&c.Confidential_to) }},
+	{"version", "version", func(c *Coltech) interface{} { return &c.Version }},
+	{"time_spent_minutes", "COALESCE(work.minutes, 0)", func(c *Coltech) interface{} { return &c.Time_spent }},
+	{"billable_minutes", "COALESCE(work.billable, 0)", func(c *Coltech) interface{} { return &c.Billable_time }},
+}
+
+// ColtechFields() returns the names of the fields a client can ask for
+func ColtechFields() []string {
+	fields := make([]string, len(coltechColumns))
+	for i, column := range coltechColumns {
+		fields[i] = column.field
+	}
+	return fields
+}
+
+func ValidateColtechFields(v *validator.Validator, fields []string) {
+	known := ColtechFields()
+	for _, field := range fields {
+		v.Check(validator.In(field, known...), "fields", fmt.Sprintf("%q is not a coltech item field", field))
+	}
+}
+
+// coltechSelection is the part of a query that selects the requested fields
+type coltechSelection struct {
+	columns []coltechColumn
+}
+
+// selectColtech() picks the columns for the fields, every column when no
+// fields are given. The id is always selected.
+func selectColtech(fields []string) coltechSelection {
+	if len(fields) == 0 {
+		return coltechSelection{columns: coltechColumns}
+	}
+	wanted := map[string]bool{"id": true}
+	for _, field := range fields {
+		wanted[field] = true
+	}
+	var sel coltechSelection
+	for _, column := range coltechColumns {
+		if wanted[column.field] {
+			sel.columns = append(sel.columns, column)
+		}
+	}
+	return sel
+}
+
+// list() returns the select list
+func (sel coltechSelection) list() string {
+	exprs := make([]string, len(sel.columns))
+	for i, column := range sel.columns {
+		exprs[i] = column.expr
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// join() returns the join for the work totals when they are selected, they
+// are the expensive part of the query
+func (sel coltechSelection) join() string {
+	for _, column := range sel.columns {
+		if strings.HasPrefix(column.expr, "COALESCE(work.") {
+			return "LEFT JOIN LATERAL (" + workTotalsQuery + ") work ON true"
+		}
+	}
+	return ""
+}
+
+// dest() returns the scan destinations for the coltech item
+func (sel coltechSelection) dest(coltech *Coltech) []interface{} {
+	dest := make([]interface{}, len(sel.columns))
+	for i, column := range sel.columns {
+		dest[i] = column.dest(coltech)
+	}
+	return dest
 }
 
 // Define a ColtechModel which wraps a sql.DB connection pool
@@ -58,35 +220,106 @@ type ColtechModel struct {
 	DB *sql.DB
 }
 
-// Insert() allows us to create a new coltech item
-func (m ColtechModel) Insert(coltech *Coltech) error {
+// Insert() allows us to create a new coltech item. The created event is
+// recorded in the same transaction.
+func (m ColtechModel) Insert(coltech *Coltech, userID int64) error {
+	_, err := m.InsertWithApprovals(coltech, userID, nil)
+	return err
+}
+
+// InsertWithApprovals() creates a coltech item along with the approvals its
+// category's steps ask for and the created event, in one transaction. The
+// approvals are returned with their tokens so the approvers can be emailed.
+func (m ColtechModel) InsertWithApprovals(coltech *Coltech, userID int64, steps []*ApprovalStep) ([]*Approval, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Cleanup to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Coltech items that need approval wait for it before work starts
+	if len(steps) > 0 {
+		coltech.Status_val = StatusAwaitingApproval
+	}
+	err = insertColtech(ctx, tx, coltech)
+	if err != nil {
+		return nil, err
+	}
+	approvals, err := insertApprovals(ctx, tx, coltech, steps)
+	if err != nil {
+		return nil, err
+	}
+	err = insertEvent(ctx, tx, &Event{Type: EventCreated, User_id: userID, Coltech: coltech})
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// insertColtech() runs the insert for Insert() and for other models' transactions
+func insertColtech(ctx context.Context, tx *sql.Tx, coltech *Coltech) error {
+	// Take the next key in the department's sequence
+	key, err := nextColtechKey(ctx, tx, coltech.Department)
+	if err != nil {
+		return err
+	}
 	query := `
-	INSERT INTO tblcoltech (summary, description, category, department, created_by)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id, created_on, version
+	INSERT INTO tblcoltech (summary, description, category, department, created_by, assigned_to, custom_fields, tags, priority_val, requester_id, key, priority_reason, impact, urgency, status_val, confidential, confidential_to)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8::text[], '{}'), COALESCE(NULLIF($9, ''), 'MEDIUM'), NULLIF($10, 0), $11, $12, COALESCE(NULLIF($13, ''), 'MEDIUM'), COALESCE(NULLIF($14, ''), 'MEDIUM'), COALESCE(NULLIF($15, ''), 'OPEN'), $16, COALESCE($17::bigint[], '{}'))
+	RETURNING id, key, created_on, priority_val, impact, urgency, status_val, version
 	`
 	// Collect the data fields into a slice
 	args := []interface{}{
 		coltech.Summary, coltech.Description,
 		coltech.Category, coltech.Department,
-		coltech.Created_by,
+		coltech.Created_by, coltech.Assigned_to,
+		coltech.Custom_fields, pq.Array(coltech.Tags),
+		coltech.Priority_val, coltech.Requester_id,
+		key, coltech.Priority_reason,
+		coltech.Impact, coltech.Urgency,
+		coltech.Status_val, coltech.Confidential,
+		pq.Array(coltech.Confidential_to),
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// Cleanup to prevent memory leaks
-	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&coltech.ID, &coltech.Created_on, &coltech.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&coltech.ID, &coltech.Key, &coltech.Created_on, &coltech.Priority_val, &coltech.Impact, &coltech.Urgency, &coltech.Status_val, &coltech.Version)
+	if err != nil {
+		return err
+	}
+	query = `
+		INSERT INTO coltech_keys (key, coltech_id)
+		VALUES ($1, $2)
+	`
+	_, err = tx.ExecContext(ctx, query, coltech.Key, coltech.ID)
+	return err
+}
+
+// GET() allows us to retrieve a specific coltech item. One the viewer may
+// not see is not found.
+func (m ColtechModel) Get(id int64, viewer *Viewer) (*Coltech, error) {
+	return m.GetFields(id, nil, viewer)
 }
 
-// GET() allows us to retrieve a specific coltech item
-func (m ColtechModel) Get(id int64) (*Coltech, error) {
+// GetFields() retrieves a specific coltech item with only the given fields
+// (and its id) filled in, every field when none are given
+func (m ColtechModel) GetFields(id int64, fields []string, viewer *Viewer) (*Coltech, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
+	sel := selectColtech(fields)
+	visible, args := viewer.clause(2)
 	// Create query
 	query := `
-		SELECT id, created_on, summary, description, priority_val, status_val, assigned_to, category, department, closed_on, created_by, due_on, version
+		SELECT ` + sel.list() + `
 		FROM tblcoltech
+		` + sel.join() + `
 		WHERE id = $1
+		AND ` + visible + `
 	`
 	// Declare a Coltech variable to hold the return data
 	var coltech Coltech
@@ -94,22 +327,8 @@ func (m ColtechModel) Get(id int64) (*Coltech, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-
-		&coltech.ID,
-		&coltech.Created_on,
-		&coltech.Summary,
-		&coltech.Description,
-		&coltech.Priority_val,
-		&coltech.Status_val,
-		&coltech.Assigned_to,
-		&coltech.Category,
-		&coltech.Department,
-		&coltech.Closed_on,
-		&coltech.Created_by,
-		&coltech.Due_on,
-		&coltech.Version,
-	)
+	args = append([]interface{}{id}, args...)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(sel.dest(&coltech)...)
 	// Handle any errors
 	if err != nil {
 		// Check the type of error
@@ -125,17 +344,98 @@ func (m ColtechModel) Get(id int64) (*Coltech, error) {
 }
 
 // Update() allows us to edit/alter a coltech item in the list
-func (m ColtechModel) Update(coltech *Coltech) error {
+func (m ColtechModel) Update(coltech *Coltech, userID int64) error {
+	_, err := m.UpdateWithHistory(coltech, userID, nil, nil, nil)
+	return err
+}
+
+// UpdateWithHistory() saves the coltech item, its history entries, an
+// optional comment, the approvals asked for by steps and their events in one
+// transaction so that either all or none are kept
+func (m ColtechModel) UpdateWithHistory(coltech *Coltech, userID int64, history []*HistoryEntry, comment *Comment, steps []*ApprovalStep) ([]*Approval, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = updateColtech(ctx, tx, coltech)
+	if err != nil {
+		return nil, err
+	}
+	err = insertHistory(ctx, tx, history)
+	if err != nil {
+		return nil, err
+	}
+	approvals, err := insertApprovals(ctx, tx, coltech, steps)
+	if err != nil {
+		return nil, err
+	}
+	// A macro that only adds a comment has nothing to report as updated
+	if comment == nil || len(history) > 0 {
+		err = insertEvent(ctx, tx, &Event{Type: EventUpdated, User_id: userID, Coltech: coltech})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if comment != nil {
+		err = insertComment(ctx, tx, comment)
+		if err != nil {
+			return nil, err
+		}
+		err = insertEvent(ctx, tx, &Event{Type: EventCommented, User_id: userID, Coltech: coltech, Comment: comment})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// AddComment() adds a comment to the coltech item and records the commented event
+func (m ColtechModel) AddComment(coltech *Coltech, comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertComment(ctx, tx, comment)
+	if err != nil {
+		return err
+	}
+	err = insertEvent(ctx, tx, &Event{Type: EventCommented, User_id: comment.User_id, Coltech: coltech, Comment: comment})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateColtech() runs the versioned update for Update() and UpdateWithHistory()
+func updateColtech(ctx context.Context, tx *sql.Tx, coltech *Coltech) error {
+	// The old row's department is returned to tell whether the coltech item
+	// moved and needs a key in its new department
 	query := `
 		UPDATE tblcoltech 
 		set summary = $2, description = $3, 
 		priority_val = $4, status_val = $5, assigned_to = $6,
 		category = $7, department = $8, closed_on = $9,
-		created_by = $10, due_on = $11, 
-		version = version + 1
-		WHERE id = $1
-		AND version = $12
-		RETURNING version
+		created_by = $10, due_on = $11, custom_fields = $13, tags = COALESCE($14::text[], '{}'),
+		priority_reason = $15, impact = $16, urgency = $17,
+		confidential = $18, confidential_to = COALESCE($19::bigint[], '{}'),
+		version = tblcoltech.version + 1
+		FROM (SELECT department FROM tblcoltech WHERE id = $1) AS old
+		WHERE tblcoltech.id = $1
+		AND tblcoltech.version = $12
+		RETURNING tblcoltech.version, old.department
 	`
 	args := []interface{}{
 		coltech.ID,
@@ -150,13 +450,17 @@ func (m ColtechModel) Update(coltech *Coltech) error {
 		coltech.Created_by,
 		coltech.Due_on,
 		coltech.Version,
+		coltech.Custom_fields,
+		pq.Array(coltech.Tags),
+		coltech.Priority_reason,
+		coltech.Impact,
+		coltech.Urgency,
+		coltech.Confidential,
+		pq.Array(coltech.Confidential_to),
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	// Cleanup to prevent memory leaks
-	defer cancel()
 	// Check for edit conflicts
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&coltech.Version)
+	var oldDepartment string
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&coltech.Version, &oldDepartment)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -165,59 +469,118 @@ func (m ColtechModel) Update(coltech *Coltech) error {
 			return err
 		}
 	}
+	if oldDepartment != coltech.Department {
+		return assignColtechKey(ctx, tx, coltech)
+	}
 	return nil
 }
 
-// Delete() removes a specific coltech item from the list
-func (m ColtechModel) Delete(id int64) error {
+// Delete() removes a specific coltech item from the list. A version other
+// than zero must match the stored one, otherwise ErrEditConflict is returned.
+// The deleted event keeps a copy of the coltech item as it was. Coltech
+// items the viewer may not see are not found.
+func (m ColtechModel) Delete(id int64, version int32, viewer *Viewer) error {
 	// Ensure that there is a valid id
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	// Create the delete query
+	visible, args := viewer.clause(3)
 	query := `
 		DELETE FROM tblcoltech
 		WHERE id = $1
+		AND ($2 = 0 OR version = $2)
+		AND ` + visible + `
+		RETURNING id, key, created_on, summary, description, priority_val, priority_reason, impact, urgency, status_val, assigned_to, category, department, closed_on, created_by, COALESCE(requester_id, 0), due_on, custom_fields, tags, confidential, confidential_to, version
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
-	// Execute the query
-	results, err := m.DB.ExecContext(ctx, query, id)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	// Check how many rows were affected by the delete operations. We
-	// call the RowsAffected() method on the result variable
-	rowsAffected, err := results.RowsAffected()
+	defer tx.Rollback()
+
+	// Execute the query, no row back means there was nothing to delete
+	var coltech Coltech
+	args = append([]interface{}{id, version}, args...)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&coltech.ID,
+		&coltech.Key,
+		&coltech.Created_on,
+		&coltech.Summary,
+		&coltech.Description,
+		&coltech.Priority_val,
+		&coltech.Priority_reason,
+		&coltech.Impact,
+		&coltech.Urgency,
+		&coltech.Status_val,
+		&coltech.Assigned_to,
+		&coltech.Category,
+		&coltech.Department,
+		&coltech.Closed_on,
+		&coltech.Created_by,
+		&coltech.Requester_id,
+		&coltech.Due_on,
+		&coltech.Custom_fields,
+		pq.Array(&coltech.Tags),
+		&coltech.Confidential,
+		pq.Array(&coltech.Confidential_to),
+		&coltech.Version,
+	)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrEditConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
 	}
-	// Check if no rows were affected
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	err = insertEvent(ctx, tx, &Event{Type: EventDeleted, User_id: viewer.UserID, Coltech: &coltech})
+	if err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
-// The GetAll() returns a list of all the coltech items sorted by ID
-func (m ColtechModel) GetAll(created_by string, assigned_to string, priority_val string, status_val string, filters Filters) ([]*Coltech, Metadata, error) {
+// The GetAll() returns a list of the coltech items the viewer can see sorted
+// by ID. Only the given fields are filled in, every field when none are given.
+func (m ColtechModel) GetAll(created_by string, assigned_to string, priority_val string, status_val string, custom map[string]string, fields []string, filters Filters, viewer *Viewer) ([]*Coltech, Metadata, error) {
+	// Split the custom field filters into parallel slices of names and values
+	customNames := make([]string, 0, len(custom))
+	customValues := make([]string, 0, len(custom))
+	for name, value := range custom {
+		customNames = append(customNames, name)
+		customValues = append(customValues, value)
+	}
 	// Construct the query
+	sel := selectColtech(fields)
+	visible, visibleArgs := viewer.clause(9)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, created_on, summary, description, priority_val, status_val, assigned_to, category, department, closed_on, created_by, due_on, version
+		SELECT COUNT(*) OVER(), `+sel.list()+`
 		FROM tblcoltech
+		`+sel.join()+`
 		WHERE (to_tsvector('simple',created_by) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (to_tsvector('simple',assigned_to) @@ plainto_tsquery('simple', $2) OR $2 = '')
 		AND (to_tsvector('simple',priority_val) @@ plainto_tsquery('simple', $4) OR $4 = '')
 		AND (to_tsvector('simple',status_val) @@ plainto_tsquery('simple', $3) OR $3 = '')
-				
+		AND NOT EXISTS (
+			SELECT 1 FROM unnest($7::text[], $8::text[]) AS filter(name, value)
+			WHERE custom_fields ->> filter.name IS DISTINCT FROM filter.value
+		)
+		AND `+visible+`
 		ORDER BY %s %s, id ASC
 		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortOrder())
 
 	// Create a 3-second-timeout context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	args := []interface{}{created_by, assigned_to, priority_val, status_val, filters.limit(), filters.offset()}
+	args := []interface{}{created_by, assigned_to, priority_val, status_val, filters.limit(), filters.offset(), pq.Array(customNames), pq.Array(customValues)}
+	args = append(args, visibleArgs...)
 	// Execute query
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -232,22 +595,7 @@ func (m ColtechModel) GetAll(created_by string, assigned_to string, priority_val
 	for rows.Next() {
 		var coltech Coltech
 		// Scan the values from the row in to the Coltech struct
-		err := rows.Scan(
-			&totalRecords,
-			&coltech.ID,
-			&coltech.Created_on,
-			&coltech.Summary,
-			&coltech.Description,
-			&coltech.Priority_val,
-			&coltech.Status_val,
-			&coltech.Assigned_to,
-			&coltech.Category,
-			&coltech.Department,
-			&coltech.Closed_on,
-			&coltech.Created_by,
-			&coltech.Due_on,
-			&coltech.Version,
-		)
+		err := rows.Scan(append([]interface{}{&totalRecords}, sel.dest(&coltech)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
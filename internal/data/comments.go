@@ -0,0 +1,135 @@
+// Filename: internal/data/comments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// A Comment is a note added to a coltech item's conversation
+type Comment struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Coltech_id int64     `json:"coltech_id"`
+	User_id    int64     `json:"user_id"`
+	Author     string    `json:"author"`
+	Body       string    `json:"body"`
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+}
+
+// Define a CommentModel which wraps a sql.DB connection pool
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx so that comments can
+// be added on their own or as part of a larger transaction
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertComment() adds a comment to a coltech item as part of a ColtechModel transaction
+func insertComment(ctx context.Context, q queryRower, comment *Comment) error {
+	query := `
+		INSERT INTO comments (coltech_id, user_id, body)
+		VALUES ($1, NULLIF($2, 0), $3)
+		RETURNING id, created_on
+	`
+	args := []interface{}{comment.Coltech_id, comment.User_id, comment.Body}
+	return q.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.Created_on)
+}
+
+// GetAllForColtech() returns a coltech item's comments, oldest first
+func (m CommentModel) GetAllForColtech(coltechID int64) ([]*Comment, error) {
+	query := `
+		SELECT comments.id, comments.created_on, comments.coltech_id,
+		COALESCE(comments.user_id, 0), COALESCE(tblusers.name, ''), comments.body
+		FROM comments
+		LEFT JOIN tblusers
+		ON comments.user_id = tblusers.id
+		WHERE comments.coltech_id = $1
+		ORDER BY comments.created_on, comments.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, coltechID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.Created_on,
+			&comment.Coltech_id,
+			&comment.User_id,
+			&comment.Author,
+			&comment.Body,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// GetLatestForColtechs() returns the newest comment on each of the coltech
+// items keyed by coltech item id, items without comments are left out
+func (m CommentModel) GetLatestForColtechs(coltechIDs []int64) (map[int64]*Comment, error) {
+	query := `
+		SELECT DISTINCT ON (comments.coltech_id)
+		comments.id, comments.created_on, comments.coltech_id,
+		COALESCE(comments.user_id, 0), COALESCE(tblusers.name, ''), comments.body
+		FROM comments
+		LEFT JOIN tblusers
+		ON comments.user_id = tblusers.id
+		WHERE comments.coltech_id = ANY($1)
+		ORDER BY comments.coltech_id, comments.created_on DESC, comments.id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(coltechIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make(map[int64]*Comment)
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.Created_on,
+			&comment.Coltech_id,
+			&comment.User_id,
+			&comment.Author,
+			&comment.Body,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments[comment.Coltech_id] = &comment
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
@@ -0,0 +1,312 @@
+// Filename: internal/data/customfields.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Custom field types
+const (
+	FieldString  = "string"
+	FieldNumber  = "number"
+	FieldDate    = "date"
+	FieldEnum    = "enum"
+	FieldBoolean = "boolean"
+)
+
+var (
+	ErrDuplicateField = errors.New("duplicate custom field")
+	// Field names double as JSON keys and query string keys
+	FieldNameRx = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+)
+
+// A CustomField defines an extra typed value that coltech items in a
+// category carry in their custom_fields column
+type CustomField struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Category   string    `json:"category"`
+	Name       string    `json:"name"`
+	Label      string    `json:"label"`
+	Type       string    `json:"type"`
+	Options    []string  `json:"options"`
+	Required   bool      `json:"required"`
+	Version    int32     `json:"version"`
+}
+
+func ValidateCustomField(v *validator.Validator, field *CustomField) {
+	// Category validation
+	v.Check(field.Category != "", "category", "must be provided")
+	v.Check(len(field.Category) <= 200, "category", "must not be more than 200 bytes long")
+	// Name validation
+	v.Check(field.Name != "", "name", "must be provided")
+	v.Check(validator.Matches(field.Name, FieldNameRx), "name", "must start with a letter and only contain lowercase letters, digits and underscores")
+	// Label validation
+	v.Check(len(field.Label) <= 200, "label", "must not be more than 200 bytes long")
+	// Type validation
+	v.Check(validator.In(field.Type, FieldString, FieldNumber, FieldDate, FieldEnum, FieldBoolean), "type", "must be string, number, date, enum or boolean")
+	// Only enums have options
+	if field.Type == FieldEnum {
+		v.Check(len(field.Options) > 0, "options", "must contain at least one option")
+		v.Check(validator.Unique(field.Options), "options", "must not contain duplicate values")
+	} else {
+		v.Check(len(field.Options) == 0, "options", "must only be provided for enum fields")
+	}
+}
+
+// CustomValues holds a coltech item's custom field values and maps onto a jsonb column
+type CustomValues map[string]interface{}
+
+// Value() lets CustomValues be written to postgres
+func (c CustomValues) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan() lets CustomValues be read from postgres
+func (c *CustomValues) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("custom_fields: expected []byte from jsonb column")
+	}
+	return json.Unmarshal(b, c)
+}
+
+// ValidateCustomValues() checks the values against the category's field definitions
+func ValidateCustomValues(v *validator.Validator, values CustomValues, fields []*CustomField) {
+	defined := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		defined[field.Name] = true
+		key := "custom_fields." + field.Name
+		value, ok := values[field.Name]
+		if !ok || value == nil || value == "" {
+			v.Check(!field.Required, key, "must be provided")
+			continue
+		}
+		switch field.Type {
+		case FieldString:
+			s, ok := value.(string)
+			v.Check(ok, key, "must be a string")
+			v.Check(len(s) <= 1000, key, "must not be more than 1000 bytes long")
+		case FieldNumber:
+			_, ok := value.(float64)
+			v.Check(ok, key, "must be a number")
+		case FieldDate:
+			s, _ := value.(string)
+			_, err := time.Parse("2006-01-02", s)
+			v.Check(err == nil, key, "must be a date in the format YYYY-MM-DD")
+		case FieldEnum:
+			s, _ := value.(string)
+			v.Check(validator.In(s, field.Options...), key, fmt.Sprintf("must be one of %v", field.Options))
+		case FieldBoolean:
+			_, ok := value.(bool)
+			v.Check(ok, key, "must be a boolean")
+		}
+	}
+	// Reject values that the category does not define
+	for name := range values {
+		v.Check(defined[name], "custom_fields."+name, "is not a field for this category")
+	}
+}
+
+// Define a CustomFieldModel which wraps a sql.DB connection pool
+type CustomFieldModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new custom field definition
+func (m CustomFieldModel) Insert(field *CustomField) error {
+	query := `
+		INSERT INTO custom_fields (category, name, label, type, options, required)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{
+		field.Category,
+		field.Name,
+		field.Label,
+		field.Type,
+		pq.Array(field.Options),
+		field.Required,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&field.ID, &field.Created_on, &field.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateField
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific custom field definition
+func (m CustomFieldModel) Get(id int64) (*CustomField, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, category, name, label, type, options, required, version
+		FROM custom_fields
+		WHERE id = $1
+	`
+	var field CustomField
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&field.ID,
+		&field.Created_on,
+		&field.Category,
+		&field.Name,
+		&field.Label,
+		&field.Type,
+		pq.Array(&field.Options),
+		&field.Required,
+		&field.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &field, nil
+}
+
+// GetAll() returns the custom field definitions for a category, or for every
+// category when category is empty
+func (m CustomFieldModel) GetAll(category string) ([]*CustomField, error) {
+	query := `
+		SELECT id, created_on, category, name, label, type, options, required, version
+		FROM custom_fields
+		WHERE (category = $1 OR $1 = '')
+		ORDER BY category, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []*CustomField{}
+	for rows.Next() {
+		var field CustomField
+		err := rows.Scan(
+			&field.ID,
+			&field.Created_on,
+			&field.Category,
+			&field.Name,
+			&field.Label,
+			&field.Type,
+			pq.Array(&field.Options),
+			&field.Required,
+			&field.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, &field)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Update() allows us to edit a custom field definition. The category, name
+// and type are fixed once created so stored values keep their meaning.
+func (m CustomFieldModel) Update(field *CustomField) error {
+	query := `
+		UPDATE custom_fields
+		SET label = $2, options = $3, required = $4, version = version + 1
+		WHERE id = $1
+		AND version = $5
+		RETURNING version
+	`
+	args := []interface{}{
+		field.ID,
+		field.Label,
+		pq.Array(field.Options),
+		field.Required,
+		field.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&field.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a custom field definition along with the values stored
+// for it on the category's coltech items
+func (m CustomFieldModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM custom_fields
+		WHERE id = $1
+		RETURNING category, name
+	`
+	var category, name string
+	err = tx.QueryRowContext(ctx, query, id).Scan(&category, &name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	query = `
+		UPDATE tblcoltech
+		SET custom_fields = custom_fields - $2::text
+		WHERE category = $1
+		AND custom_fields ? $2
+	`
+	_, err = tx.ExecContext(ctx, query, category, name)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
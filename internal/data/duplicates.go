@@ -0,0 +1,75 @@
+// Filename: internal/data/duplicates.go
+
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A PossibleDuplicate is an open coltech item that looks like a new one.
+// Similarity runs from 0 to 1, the higher of the summary and description
+// trigram similarities.
+type PossibleDuplicate struct {
+	ID         int64     `json:"id"`
+	Key        string    `json:"key"`
+	Created_on time.Time `json:"created_on"`
+	Summary    string    `json:"summary"`
+	Status_val string    `json:"status_val"`
+	Similarity float64   `json:"similarity"`
+}
+
+// GetSimilar() returns the open coltech items in the department created since
+// the given time whose summary or description is similar to the ones given,
+// most similar first. The % operator uses pg_trgm's similarity threshold so
+// that the trigram indexes can be used. Coltech items the viewer may not see
+// are left out.
+func (m ColtechModel) GetSimilar(summary, description, department string, since time.Time, limit int, viewer *Viewer) ([]*PossibleDuplicate, error) {
+	visible, visibleArgs := viewer.clause(7)
+	query := `
+		SELECT id, key, created_on, summary, status_val,
+		GREATEST(similarity(summary, $1), similarity(description, $2)) AS score
+		FROM tblcoltech
+		WHERE (summary % $1 OR description % $2)
+		AND department = $3
+		AND created_on >= $4
+		AND status_val <> ALL($5)
+		AND ` + visible + `
+		ORDER BY score DESC, id DESC
+		LIMIT $6
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	finished := []string{StatusClosed, StatusRejected}
+	args := []interface{}{summary, description, department, since, pq.Array(finished), limit}
+	args = append(args, visibleArgs...)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []*PossibleDuplicate{}
+	for rows.Next() {
+		var duplicate PossibleDuplicate
+		err := rows.Scan(
+			&duplicate.ID,
+			&duplicate.Key,
+			&duplicate.Created_on,
+			&duplicate.Summary,
+			&duplicate.Status_val,
+			&duplicate.Similarity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, &duplicate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
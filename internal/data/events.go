@@ -0,0 +1,230 @@
+// Filename: internal/data/events.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of change an Event can describe
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated"
+	EventDeleted   = "deleted"
+	EventCommented = "commented"
+)
+
+// EventsChannel is the Postgres NOTIFY channel that new event ids are sent
+// on so that every API instance hears about every change
+const EventsChannel = "ticket_events"
+
+// An Event records a change to a coltech item so that it can be pushed to
+// clients and replayed to those who reconnect
+type Event struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Type       string    `json:"type"`
+	Coltech_id int64     `json:"coltech_id"`
+	User_id    int64     `json:"user_id"`
+	Coltech    *Coltech  `json:"coltech"`
+	Comment    *Comment  `json:"comment,omitempty"`
+}
+
+// eventPayload is what gets stored in the payload column
+type eventPayload struct {
+	Coltech *Coltech `json:"coltech"`
+	Comment *Comment `json:"comment,omitempty"`
+}
+
+// EventFilter holds the same filters as ColtechModel.GetAll() so that a stream
+// of events can be limited to the coltech items a listing would show
+type EventFilter struct {
+	Created_by   string
+	Assigned_to  string
+	Priority_val string
+	Status_val   string
+	Custom       map[string]string
+}
+
+// Matches() reports whether the event's coltech item passes the filter. The
+// text filters behave like the full text search in GetAll(), every word in
+// the filter must appear in the field.
+func (f EventFilter) Matches(event *Event) bool {
+	coltech := event.Coltech
+	if coltech == nil {
+		return false
+	}
+	if !matchesWords(coltech.Created_by, f.Created_by) ||
+		!matchesWords(coltech.Assigned_to, f.Assigned_to) ||
+		!matchesWords(coltech.Priority_val, f.Priority_val) ||
+		!matchesWords(coltech.Status_val, f.Status_val) {
+		return false
+	}
+	for name, value := range f.Custom {
+		if customText(coltech.Custom_fields[name]) != value {
+			return false
+		}
+	}
+	return true
+}
+
+var wordRx = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// matchesWords() is the Go side of to_tsvector('simple', ...) @@ plainto_tsquery('simple', ...)
+func matchesWords(value, query string) bool {
+	if query == "" {
+		return true
+	}
+	words := map[string]bool{}
+	for _, word := range wordRx.FindAllString(strings.ToLower(value), -1) {
+		words[word] = true
+	}
+	for _, word := range wordRx.FindAllString(strings.ToLower(query), -1) {
+		if !words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// customText() is the Go side of custom_fields ->> name
+func customText(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		js, _ := json.Marshal(value)
+		return string(js)
+	}
+}
+
+// Define an EventModel which wraps a sql.DB connection pool
+type EventModel struct {
+	DB *sql.DB
+}
+
+// insertEvent() records an event as part of a ColtechModel transaction and
+// notifies the listening API instances. Postgres only delivers the
+// notification once the transaction commits.
+func insertEvent(ctx context.Context, tx *sql.Tx, event *Event) error {
+	event.Coltech_id = event.Coltech.ID
+	payload, err := json.Marshal(eventPayload{Coltech: event.Coltech, Comment: event.Comment})
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO ticket_events (type, coltech_id, user_id, payload)
+		VALUES ($1, $2, NULLIF($3, 0), $4)
+		RETURNING id, created_on
+	`
+	args := []interface{}{event.Type, event.Coltech_id, event.User_id, payload}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.Created_on)
+	if err != nil {
+		return err
+	}
+	// Webhook deliveries are queued in the same transaction so that an event
+	// is never recorded without them
+	err = enqueueDeliveries(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+	// Only the id is sent, notification payloads are limited to 8000 bytes
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", EventsChannel, strconv.FormatInt(event.ID, 10))
+	return err
+}
+
+// Get() returns a specific event
+func (m EventModel) Get(id int64) (*Event, error) {
+	query := `
+		SELECT id, created_on, type, coltech_id, COALESCE(user_id, 0), payload
+		FROM ticket_events
+		WHERE id = $1
+	`
+	events, err := m.query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return events[0], nil
+}
+
+// GetSince() returns up to limit events recorded after the given event id,
+// oldest first. It is used to catch up clients that reconnect.
+func (m EventModel) GetSince(id int64, limit int) ([]*Event, error) {
+	query := `
+		SELECT id, created_on, type, coltech_id, COALESCE(user_id, 0), payload
+		FROM ticket_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+	return m.query(query, id, limit)
+}
+
+// query() runs an event listing query
+func (m EventModel) query(query string, args ...interface{}) ([]*Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		var event Event
+		var payload []byte
+		err := rows.Scan(
+			&event.ID,
+			&event.Created_on,
+			&event.Type,
+			&event.Coltech_id,
+			&event.User_id,
+			&payload,
+		)
+		if err != nil {
+			return nil, err
+		}
+		var p eventPayload
+		err = json.Unmarshal(payload, &p)
+		if err != nil {
+			return nil, err
+		}
+		event.Coltech = p.Coltech
+		event.Comment = p.Comment
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DeleteOlderThan() removes events recorded before the cutoff, clients that
+// have been away longer than that can no longer resume
+func (m EventModel) DeleteOlderThan(cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM ticket_events
+		WHERE created_on < $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return results.RowsAffected()
+}
@@ -0,0 +1,176 @@
+// Filename: internal/data/history.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// A HistoryEntry records one field of a coltech item changing. Source says
+// what made the change when it was not a plain edit, e.g. "macro:escalate".
+// Reason is why an overridden priority was set.
+type HistoryEntry struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Coltech_id int64     `json:"coltech_id"`
+	User_id    int64     `json:"user_id"`
+	Field      string    `json:"field"`
+	Old_value  string    `json:"old_value"`
+	New_value  string    `json:"new_value"`
+	Source     string    `json:"source,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// DiffColtech() returns a history entry for every field that differs between
+// the old and new copies of a coltech item
+func DiffColtech(old, new *Coltech, userID int64, source string) []*HistoryEntry {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"summary", old.Summary, new.Summary},
+		{"description", old.Description, new.Description},
+		{"priority_val", old.Priority_val, new.Priority_val},
+		{"impact", old.Impact, new.Impact},
+		{"urgency", old.Urgency, new.Urgency},
+		{"status_val", old.Status_val, new.Status_val},
+		{"assigned_to", old.Assigned_to, new.Assigned_to},
+		{"category", old.Category, new.Category},
+		{"department", old.Department, new.Department},
+		{"closed_on", historyTime(old.Closed_on), historyTime(new.Closed_on)},
+		{"created_by", old.Created_by, new.Created_by},
+		{"due_on", historyTime(old.Due_on), historyTime(new.Due_on)},
+		{"custom_fields", historyJSON(old.Custom_fields), historyJSON(new.Custom_fields)},
+		{"tags", historyJSON(old.Tags), historyJSON(new.Tags)},
+		{"confidential", strconv.FormatBool(old.Confidential), strconv.FormatBool(new.Confidential)},
+		{"confidential_to", historyJSON(old.Confidential_to), historyJSON(new.Confidential_to)},
+	}
+	entries := []*HistoryEntry{}
+	for _, field := range fields {
+		if field.old == field.new {
+			continue
+		}
+		entry := &HistoryEntry{
+			Coltech_id: new.ID,
+			User_id:    userID,
+			Field:      field.name,
+			Old_value:  field.old,
+			New_value:  field.new,
+			Source:     source,
+		}
+		if field.name == "priority_val" {
+			entry.Reason = new.Priority_reason
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// historyTime() formats a time for the history, the zero time means not set
+func historyTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// historyJSON() formats tags, ids and custom fields for the history. Empty and nil
+// values are treated the same so that they do not show up as changes.
+func historyJSON(value interface{}) string {
+	switch value := value.(type) {
+	case []string:
+		if len(value) == 0 {
+			return "[]"
+		}
+	case []int64:
+		if len(value) == 0 {
+			return "[]"
+		}
+	case CustomValues:
+		if len(value) == 0 {
+			return "{}"
+		}
+	}
+	// Map keys are sorted by encoding/json so equal values give equal strings
+	js, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(js)
+}
+
+// insertHistory() writes history entries as part of a transaction
+func insertHistory(ctx context.Context, tx *sql.Tx, entries []*HistoryEntry) error {
+	query := `
+		INSERT INTO ticket_history (coltech_id, user_id, field, old_value, new_value, source, reason)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7)
+		RETURNING id, created_on
+	`
+	for _, entry := range entries {
+		args := []interface{}{
+			entry.Coltech_id,
+			entry.User_id,
+			entry.Field,
+			entry.Old_value,
+			entry.New_value,
+			entry.Source,
+			entry.Reason,
+		}
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.Created_on)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Define a HistoryModel which wraps a sql.DB connection pool
+type HistoryModel struct {
+	DB *sql.DB
+}
+
+// GetAllForColtech() returns a coltech item's history, oldest first
+func (m HistoryModel) GetAllForColtech(coltechID int64) ([]*HistoryEntry, error) {
+	query := `
+		SELECT id, created_on, coltech_id, COALESCE(user_id, 0), field, old_value, new_value, source, reason
+		FROM ticket_history
+		WHERE coltech_id = $1
+		ORDER BY created_on, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, coltechID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.Created_on,
+			&entry.Coltech_id,
+			&entry.User_id,
+			&entry.Field,
+			&entry.Old_value,
+			&entry.New_value,
+			&entry.Source,
+			&entry.Reason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,143 @@
+// Filename: internal/data/idempotency.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// An IdempotencyKey remembers the response to a request so that a client
+// retrying the same request gets the same response instead of a duplicate
+type IdempotencyKey struct {
+	User_id     int64
+	Key         string
+	Fingerprint string
+	Status_code int
+	Headers     map[string]string
+	Body        []byte
+	Created_on  time.Time
+	Expires_on  time.Time
+}
+
+// Pending() reports whether the first request with the key is still running
+func (k *IdempotencyKey) Pending() bool {
+	return k.Status_code == 0
+}
+
+// Define an IdempotencyModel which wraps a sql.DB connection pool
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Reserve() claims the key for a new request and returns nil. When the user
+// already has an unexpired key with that name it is returned instead and
+// nothing is claimed.
+func (m IdempotencyModel) Reserve(userID int64, key string, fingerprint string, ttl time.Duration) (*IdempotencyKey, error) {
+	// An expired key is taken over as if it had never existed
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_on)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status_code = 0, headers = '{}', body = NULL,
+		created_on = NOW(), expires_on = EXCLUDED.expires_on
+		WHERE idempotency_keys.expires_on <= NOW()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, userID, key, fingerprint, time.Now().Add(ttl))
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 1 {
+		return nil, nil
+	}
+
+	query = `
+		SELECT user_id, key, fingerprint, status_code, headers, COALESCE(body, ''), created_on, expires_on
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`
+	var existing IdempotencyKey
+	var headers []byte
+	err = m.DB.QueryRowContext(ctx, query, userID, key).Scan(
+		&existing.User_id,
+		&existing.Key,
+		&existing.Fingerprint,
+		&existing.Status_code,
+		&headers,
+		&existing.Body,
+		&existing.Created_on,
+		&existing.Expires_on,
+	)
+	if err != nil {
+		switch {
+		// Removed by Release() in the meantime, the client can try again
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+	err = json.Unmarshal(headers, &existing.Headers)
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// Complete() stores the response to the request that reserved the key
+func (m IdempotencyModel) Complete(userID int64, key string, statusCode int, headers map[string]string, body []byte) error {
+	js, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, headers = $4, body = $5
+		WHERE user_id = $1 AND key = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, userID, key, statusCode, js, body)
+	return err
+}
+
+// Release() gives the key up so that a retry runs the request again, used
+// when the request failed in a way the client should not be stuck with
+func (m IdempotencyModel) Release(userID int64, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+	return err
+}
+
+// DeleteExpired() removes the keys that can no longer be replayed
+func (m IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_on <= NOW()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return results.RowsAffected()
+}
@@ -0,0 +1,163 @@
+// Filename: internal/data/keys.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColtechKeyRx matches keys such as IT-0042 or FAC2-0107
+var ColtechKeyRx = regexp.MustCompile(`^[A-Za-z]+[0-9]*-[0-9]+$`)
+
+var nonLetterRx = regexp.MustCompile(`[^A-Za-z]`)
+
+// prefixLockID is the advisory lock taken while a new department is given a
+// prefix, so that two departments starting at once cannot both pick the same
+// free one
+const prefixLockID = 7410042
+
+// departmentPrefix() is the prefix a department's keys start with before any
+// clash with another department is resolved: the first three letters of its
+// name in capitals. It matches the prefixes given out by migration 000018.
+func departmentPrefix(department string) string {
+	letters := strings.ToUpper(nonLetterRx.ReplaceAllString(department, ""))
+	if len(letters) > 3 {
+		letters = letters[:3]
+	}
+	if letters == "" {
+		return "TKT"
+	}
+	return letters
+}
+
+// freePrefix() returns the department's prefix, with the lowest number that
+// makes it unique added when another department already uses it
+func freePrefix(ctx context.Context, tx *sql.Tx, department string) (string, error) {
+	base := departmentPrefix(department)
+	query := `
+		SELECT prefix
+		FROM department_sequences
+		WHERE prefix ~ ('^' || $1 || '[0-9]*$')
+	`
+	rows, err := tx.QueryContext(ctx, query, base)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var prefix string
+		err := rows.Scan(&prefix)
+		if err != nil {
+			return "", err
+		}
+		taken[prefix] = true
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	prefix := base
+	for n := 2; taken[prefix]; n++ {
+		prefix = base + strconv.Itoa(n)
+	}
+	return prefix, nil
+}
+
+// nextColtechKey() allocates the next key in the department's sequence,
+// starting the sequence the first time the department is seen
+func nextColtechKey(ctx context.Context, tx *sql.Tx, department string) (string, error) {
+	query := `
+		UPDATE department_sequences
+		SET last_number = last_number + 1
+		WHERE department = $1
+		RETURNING prefix, last_number
+	`
+	var prefix string
+	var number int
+	err := tx.QueryRowContext(ctx, query, department).Scan(&prefix, &number)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The lock is held until the transaction ends, by when the prefix
+		// picked here is visible to whoever takes it next
+		_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, prefixLockID)
+		if err != nil {
+			return "", err
+		}
+		prefix, err = freePrefix(ctx, tx, department)
+		if err != nil {
+			return "", err
+		}
+		// Another request may have started the sequence in the meantime
+		query = `
+			INSERT INTO department_sequences (department, prefix, last_number)
+			VALUES ($1, $2, 1)
+			ON CONFLICT (department) DO UPDATE
+			SET last_number = department_sequences.last_number + 1
+			RETURNING prefix, last_number
+		`
+		err = tx.QueryRowContext(ctx, query, department, prefix).Scan(&prefix, &number)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%04d", prefix, number), nil
+}
+
+// assignColtechKey() gives the coltech item a new key in its department and
+// records it alongside the keys it had before
+func assignColtechKey(ctx context.Context, tx *sql.Tx, coltech *Coltech) error {
+	key, err := nextColtechKey(ctx, tx, coltech.Department)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE tblcoltech
+		SET key = $2
+		WHERE id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, coltech.ID, key)
+	if err != nil {
+		return err
+	}
+	query = `
+		INSERT INTO coltech_keys (key, coltech_id)
+		VALUES ($1, $2)
+	`
+	_, err = tx.ExecContext(ctx, query, key, coltech.ID)
+	if err != nil {
+		return err
+	}
+	coltech.Key = key
+	return nil
+}
+
+// ResolveKey() returns the id of the coltech item with the key, current or
+// from before it moved department. Keys are not case sensitive.
+func (m ColtechModel) ResolveKey(key string) (int64, error) {
+	query := `
+		SELECT coltech_id
+		FROM coltech_keys
+		WHERE key = upper($1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return id, nil
+}
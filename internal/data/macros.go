@@ -0,0 +1,332 @@
+// Filename: internal/data/macros.go
+
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"text/template"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateMacro = errors.New("duplicate macro")
+)
+
+// A Macro is a named bundle of field changes and an optional comment that an
+// agent applies to a coltech item in one go. Empty fields are left alone.
+type Macro struct {
+	ID           int64     `json:"id"`
+	Created_on   time.Time `json:"created_on"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Owner_id     int64     `json:"owner_id"`
+	Shared       bool      `json:"shared"`
+	Status_val   string    `json:"status_val"`
+	Priority_val string    `json:"priority_val"`
+	Assigned_to  string    `json:"assigned_to"`
+	Category     string    `json:"category"`
+	Department   string    `json:"department"`
+	Add_tags     []string  `json:"add_tags"`
+	Remove_tags  []string  `json:"remove_tags"`
+	Comment      string    `json:"comment"`
+	Version      int32     `json:"version"`
+}
+
+// macroPlaceholders builds the data a macro's comment is rendered with. The
+// keys are the placeholders available in the comment, e.g. {{ .summary }}.
+func macroPlaceholders(coltech *Coltech, agent string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           coltech.ID,
+		"summary":      coltech.Summary,
+		"status_val":   coltech.Status_val,
+		"priority_val": coltech.Priority_val,
+		"assigned_to":  coltech.Assigned_to,
+		"category":     coltech.Category,
+		"department":   coltech.Department,
+		"created_by":   coltech.Created_by,
+		"agent":        agent,
+	}
+}
+
+func ValidateMacro(v *validator.Validator, macro *Macro) {
+	// Name validation
+	v.Check(macro.Name != "", "name", "must be provided")
+	v.Check(len(macro.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(macro.Description) <= 500, "description", "must not be more than 500 bytes long")
+	// The field changes must fit in a coltech item
+	v.Check(len(macro.Status_val) <= 50, "status_val", "must not be more than 50 bytes long")
+	v.Check(len(macro.Priority_val) <= 50, "priority_val", "must not be more than 50 bytes long")
+	v.Check(len(macro.Assigned_to) <= 300, "assigned_to", "must not be more than 300 bytes long")
+	v.Check(len(macro.Category) <= 200, "category", "must not be more than 200 bytes long")
+	v.Check(len(macro.Department) <= 200, "department", "must not be more than 200 bytes long")
+	v.Check(len(macro.Add_tags) <= 20, "add_tags", "must not contain more than 20 tags")
+	v.Check(validator.Unique(macro.Add_tags), "add_tags", "must not contain duplicate values")
+	v.Check(validator.Unique(macro.Remove_tags), "remove_tags", "must not contain duplicate values")
+	for _, tag := range macro.Add_tags {
+		v.Check(tag != "", "add_tags", "must not contain empty values")
+		v.Check(!validator.In(tag, macro.Remove_tags...), "add_tags", "must not contain tags that are also removed")
+	}
+	// A macro that does nothing is a mistake
+	v.Check(macro.Status_val != "" || macro.Priority_val != "" || macro.Assigned_to != "" ||
+		macro.Category != "" || macro.Department != "" || len(macro.Add_tags) > 0 ||
+		len(macro.Remove_tags) > 0 || macro.Comment != "", "macro", "must change at least one field or add a comment")
+	// Comment validation, render it against an empty coltech item to catch
+	// syntax errors and unknown placeholders now rather than when applied
+	v.Check(len(macro.Comment) <= 5000, "comment", "must not be more than 5000 bytes long")
+	if macro.Comment != "" {
+		_, err := macro.RenderComment(&Coltech{}, "")
+		if err != nil {
+			v.AddError("comment", "must be a valid template: "+err.Error())
+		}
+	}
+}
+
+// Apply() makes the macro's field changes to the coltech item
+func (m *Macro) Apply(coltech *Coltech) {
+	if m.Status_val != "" {
+		coltech.Status_val = m.Status_val
+	}
+	// The macro's priority overrides the matrix
+	if m.Priority_val != "" {
+		coltech.Priority_val = m.Priority_val
+		coltech.Priority_reason = "macro:" + m.Name
+	}
+	if m.Assigned_to != "" {
+		coltech.Assigned_to = m.Assigned_to
+	}
+	if m.Category != "" {
+		coltech.Category = m.Category
+	}
+	if m.Department != "" {
+		coltech.Department = m.Department
+	}
+	// Build a new slice so the original coltech item's tags are not touched
+	tags := []string{}
+	for _, tag := range coltech.Tags {
+		if !validator.In(tag, m.Remove_tags...) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range m.Add_tags {
+		if !validator.In(tag, tags...) {
+			tags = append(tags, tag)
+		}
+	}
+	coltech.Tags = tags
+}
+
+// RenderComment() fills in the placeholders in the macro's comment
+func (m *Macro) RenderComment(coltech *Coltech, agent string) (string, error) {
+	tmpl, err := template.New("comment").Option("missingkey=error").Parse(m.Comment)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, macroPlaceholders(coltech, agent))
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Define a MacroModel which wraps a sql.DB connection pool
+type MacroModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new macro
+func (m MacroModel) Insert(macro *Macro) error {
+	query := `
+		INSERT INTO macros (name, description, owner_id, shared, status_val, priority_val,
+		assigned_to, category, department, add_tags, remove_tags, comment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE($10::text[], '{}'), COALESCE($11::text[], '{}'), $12)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{
+		macro.Name,
+		macro.Description,
+		macro.Owner_id,
+		macro.Shared,
+		macro.Status_val,
+		macro.Priority_val,
+		macro.Assigned_to,
+		macro.Category,
+		macro.Department,
+		pq.Array(macro.Add_tags),
+		pq.Array(macro.Remove_tags),
+		macro.Comment,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&macro.ID, &macro.Created_on, &macro.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateMacro
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() returns a macro the user owns or that has been shared
+func (m MacroModel) Get(id int64, userID int64) (*Macro, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, name, description, owner_id, shared, status_val, priority_val,
+		assigned_to, category, department, add_tags, remove_tags, comment, version
+		FROM macros
+		WHERE id = $1
+		AND (shared OR owner_id = $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	macro, err := scanMacro(m.DB.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return macro, nil
+}
+
+// GetAllForUser() returns the user's own macros and every shared macro
+func (m MacroModel) GetAllForUser(userID int64) ([]*Macro, error) {
+	query := `
+		SELECT id, created_on, name, description, owner_id, shared, status_val, priority_val,
+		assigned_to, category, department, add_tags, remove_tags, comment, version
+		FROM macros
+		WHERE shared OR owner_id = $1
+		ORDER BY name, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	macros := []*Macro{}
+	for rows.Next() {
+		macro, err := scanMacro(rows)
+		if err != nil {
+			return nil, err
+		}
+		macros = append(macros, macro)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return macros, nil
+}
+
+// scanMacro() reads a macro from a *sql.Row or *sql.Rows
+func scanMacro(row interface{ Scan(...interface{}) error }) (*Macro, error) {
+	var macro Macro
+	err := row.Scan(
+		&macro.ID,
+		&macro.Created_on,
+		&macro.Name,
+		&macro.Description,
+		&macro.Owner_id,
+		&macro.Shared,
+		&macro.Status_val,
+		&macro.Priority_val,
+		&macro.Assigned_to,
+		&macro.Category,
+		&macro.Department,
+		pq.Array(&macro.Add_tags),
+		pq.Array(&macro.Remove_tags),
+		&macro.Comment,
+		&macro.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &macro, nil
+}
+
+// Update() allows us to edit a macro
+func (m MacroModel) Update(macro *Macro) error {
+	query := `
+		UPDATE macros
+		SET name = $2, description = $3, shared = $4, status_val = $5, priority_val = $6,
+		assigned_to = $7, category = $8, department = $9, add_tags = COALESCE($10::text[], '{}'),
+		remove_tags = COALESCE($11::text[], '{}'), comment = $12, version = version + 1
+		WHERE id = $1
+		AND version = $13
+		RETURNING version
+	`
+	args := []interface{}{
+		macro.ID,
+		macro.Name,
+		macro.Description,
+		macro.Shared,
+		macro.Status_val,
+		macro.Priority_val,
+		macro.Assigned_to,
+		macro.Category,
+		macro.Department,
+		pq.Array(macro.Add_tags),
+		pq.Array(macro.Remove_tags),
+		macro.Comment,
+		macro.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&macro.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case isUniqueViolation(err):
+			return ErrDuplicateMacro
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific macro
+func (m MacroModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM macros
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Filename: internal/data/mentions.go
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// mentionRx matches @email and @username mentions. The @ has to start a word
+// so that an email address written without one is not taken for a mention.
+var mentionRx = regexp.MustCompile(`(?:^|[^\w.@])@([\w.%+\-]+(?:@[\w\-]+(?:\.[\w\-]+)*\.[A-Za-z]{2,})?)`)
+
+// ParseMentions() returns the distinct handles mentioned in the text, without
+// their @, in the order they first appear
+func ParseMentions(text string) []string {
+	handles := []string{}
+	seen := make(map[string]bool)
+	for _, match := range mentionRx.FindAllStringSubmatch(text, -1) {
+		// A full stop after a username ends the sentence
+		handle := strings.TrimRight(match[1], ".")
+		if handle == "" || seen[strings.ToLower(handle)] {
+			continue
+		}
+		seen[strings.ToLower(handle)] = true
+		handles = append(handles, handle)
+	}
+	return handles
+}
+
+// NewMentions() returns the handles mentioned in text that were not already
+// mentioned in previous, so that editing a description does not notify the
+// same people again
+func NewMentions(text, previous string) []string {
+	old := make(map[string]bool)
+	for _, handle := range ParseMentions(previous) {
+		old[strings.ToLower(handle)] = true
+	}
+	handles := []string{}
+	for _, handle := range ParseMentions(text) {
+		if !old[strings.ToLower(handle)] {
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// ResolveMentions() looks up the users the handles refer to, keyed by handle.
+// A handle with an @ is matched against the whole email, one without against
+// the part of the email before the @. Handles that match nobody, or more than
+// one user, are returned as unresolved.
+func (m UserModel) ResolveMentions(handles []string) (map[string]*User, []string, error) {
+	query := `
+		SELECT handle, id, created_on, name, email, activated, available, version
+		FROM unnest($1::text[]) AS handle
+		JOIN tblusers
+		ON CASE WHEN position('@' in handle) > 0
+			THEN email = handle::citext
+			ELSE split_part(email::text, '@', 1)::citext = handle::citext
+		END
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(handles))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	matches := make(map[string][]*User)
+	for rows.Next() {
+		var handle string
+		var user User
+		err := rows.Scan(
+			&handle,
+			&user.ID,
+			&user.Created_on,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Available,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		matches[handle] = append(matches[handle], &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	resolved := make(map[string]*User)
+	unresolved := []string{}
+	for _, handle := range handles {
+		if len(matches[handle]) != 1 {
+			unresolved = append(unresolved, handle)
+			continue
+		}
+		resolved[handle] = matches[handle][0]
+	}
+	return resolved, unresolved, nil
+}
+
+// GetWatchers() returns the users watching a coltech item, in the order they
+// started watching it
+func (m UserModel) GetWatchers(coltechID int64) ([]*User, error) {
+	query := `
+		SELECT tblusers.id, tblusers.created_on, tblusers.name, tblusers.email,
+		tblusers.activated, tblusers.available, tblusers.version
+		FROM watchers
+		INNER JOIN tblusers
+		ON watchers.user_id = tblusers.id
+		WHERE watchers.coltech_id = $1
+		ORDER BY watchers.created_on, tblusers.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, coltechID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Created_on,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Available,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// AddMentions() makes the mentioned users watchers of the coltech item and
+// leaves each of them an in-app notification, except for the author who
+// already knows. where says what the mention was in, such as "a comment".
+func (m NotificationModel) AddMentions(coltech *Coltech, author *User, users []*User, where string) error {
+	watcherQuery := `
+		INSERT INTO watchers (coltech_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (coltech_id, user_id) DO NOTHING
+	`
+	notificationQuery := `
+		INSERT INTO notifications (user_id, coltech_id, actor_id, kind, message)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	message := fmt.Sprintf("%s mentioned you in %s on coltech item %s", author.Name, where, coltech.Key)
+	for _, user := range users {
+		_, err = tx.ExecContext(ctx, watcherQuery, coltech.ID, user.ID)
+		if err != nil {
+			return err
+		}
+		if user.ID == author.ID {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, notificationQuery, user.ID, coltech.ID, author.ID, NotifyMention, message)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,68 @@
+// Filename: internal/data/mentions_test.go
+
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "nothing to see here", []string{}},
+		{"username", "@alice can you look?", []string{"alice"}},
+		{"username mid sentence", "thanks @alice, and @bob too", []string{"alice", "bob"}},
+		{"email mention", "ping @alice@example.com please", []string{"alice@example.com"}},
+		{"email mention with subdomain", "@bob.smith@mail.example.co.uk", []string{"bob.smith@mail.example.co.uk"}},
+		{"email without @ mention", "write to alice@example.com for access", []string{}},
+		{"@ inside a word", "foo@bar and x@y.com", []string{}},
+		{"trailing full stop", "Passed to @alice.", []string{"alice"}},
+		{"trailing full stop after email", "Passed to @alice@example.com.", []string{"alice@example.com"}},
+		{"dotted username", "@alice.smith please", []string{"alice.smith"}},
+		{"after punctuation", "(@alice) [@bob]", []string{"alice", "bob"}},
+		{"start of a line", "first\n@alice second", []string{"alice"}},
+		{"repeated", "@alice and @alice again", []string{"alice"}},
+		{"case insensitive duplicates", "@Alice and @alice and @ALICE", []string{"Alice"}},
+		{"email duplicates ignore case", "@Bob@Example.com @bob@example.com", []string{"Bob@Example.com"}},
+		{"bare @", "meet @ 5pm", []string{}},
+		{"double @", "@@alice", []string{}},
+		{"plus and percent", "@alice+it@example.com @a%b", []string{"alice+it@example.com", "a%b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseMentions(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		previous string
+		want     []string
+	}{
+		{"no previous text", "@alice @bob", "", []string{"alice", "bob"}},
+		{"already mentioned", "@alice @bob", "hello @alice", []string{"bob"}},
+		{"already mentioned in another case", "@Alice", "@alice", []string{}},
+		{"all already mentioned", "@alice again", "@alice", []string{}},
+		{"mention removed", "no one", "@alice", []string{}},
+		{"email then username are different handles", "@alice", "@alice@example.com", []string{"alice"}},
+		{"email in previous text without @", "@alice@example.com", "mail alice@example.com", []string{"alice@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewMentions(tt.text, tt.previous)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewMentions(%q, %q) = %q, want %q", tt.text, tt.previous, got, tt.want)
+			}
+		})
+	}
+}
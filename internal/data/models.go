@@ -15,18 +15,56 @@ var (
 // Create a Wrapper for our data models
 
 type Models struct {
-	Coltechs    ColtechModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	Approvals     ApprovalModel
+	Articles      ArticleModel
+	Assets        AssetModel
+	Assignments   AssignmentRuleModel
+	Coltechs      ColtechModel
+	Comments      CommentModel
+	CustomFields  CustomFieldModel
+	Events        EventModel
+	History       HistoryModel
+	Idempotency   IdempotencyModel
+	Macros        MacroModel
+	Notifications NotificationModel
+	Permissions   PermissionModel
+	Priorities    PriorityMatrixModel
+	Recurrences   RecurrenceModel
+	Reminders     ReminderModel
+	Roles         RoleModel
+	Surveys       SurveyModel
+	Templates     TemplateModel
+	Tokens        TokenModel
+	Users         UserModel
+	Webhooks      WebhookModel
+	WorkLogs      WorkLogModel
 }
 
 // NewModels() allows us to create a new Models
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Coltechs:    ColtechModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Approvals:     ApprovalModel{DB: db},
+		Articles:      ArticleModel{DB: db},
+		Assets:        AssetModel{DB: db},
+		Assignments:   AssignmentRuleModel{DB: db},
+		Coltechs:      ColtechModel{DB: db},
+		Comments:      CommentModel{DB: db},
+		CustomFields:  CustomFieldModel{DB: db},
+		Events:        EventModel{DB: db},
+		History:       HistoryModel{DB: db},
+		Idempotency:   IdempotencyModel{DB: db},
+		Macros:        MacroModel{DB: db},
+		Notifications: NotificationModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Priorities:    PriorityMatrixModel{DB: db},
+		Recurrences:   RecurrenceModel{DB: db},
+		Reminders:     ReminderModel{DB: db},
+		Roles:         RoleModel{DB: db},
+		Surveys:       SurveyModel{DB: db},
+		Templates:     TemplateModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Users:         UserModel{DB: db},
+		Webhooks:      WebhookModel{DB: db},
+		WorkLogs:      WorkLogModel{DB: db},
 	}
 }
@@ -0,0 +1,197 @@
+// Filename: internal/data/notifications.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The kinds of notification email a user can turn off
+const (
+	NotifyDueReminder = "due_reminder"
+	NotifyOverdue     = "overdue"
+	NotifyMention     = "mention"
+)
+
+// NotificationKinds lists every kind of notification
+var NotificationKinds = []string{NotifyDueReminder, NotifyOverdue, NotifyMention}
+
+// NotificationPreferences records which kinds of notification a user wants
+type NotificationPreferences map[string]bool
+
+// Wants() reports whether the user wants the kind of notification, users
+// get every kind they have not turned off
+func (p NotificationPreferences) Wants(kind string) bool {
+	enabled, ok := p[kind]
+	return !ok || enabled
+}
+
+// A Notification is shown to a user in the app until they mark it read
+type Notification struct {
+	ID         int64      `json:"id"`
+	Created_on time.Time  `json:"created_on"`
+	Coltech_id int64      `json:"coltech_id"`
+	Actor_id   int64      `json:"actor_id"`
+	Kind       string     `json:"kind"`
+	Message    string     `json:"message"`
+	Read_on    *time.Time `json:"read_on"`
+}
+
+func ValidateNotificationPreferences(v *validator.Validator, prefs NotificationPreferences) {
+	for kind := range prefs {
+		v.Check(validator.In(kind, NotificationKinds...), kind, "is not a kind of notification")
+	}
+}
+
+// Define a NotificationModel which wraps a sql.DB connection pool
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// GetForUser() returns the user's preferences with every kind filled in
+func (m NotificationModel) GetForUser(userID int64) (NotificationPreferences, error) {
+	query := `
+		SELECT kind, enabled
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := NotificationPreferences{}
+	for _, kind := range NotificationKinds {
+		prefs[kind] = true
+	}
+	for rows.Next() {
+		var kind string
+		var enabled bool
+		err := rows.Scan(&kind, &enabled)
+		if err != nil {
+			return nil, err
+		}
+		prefs[kind] = enabled
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// Set() saves the given preferences, kinds that are left out keep their
+// current setting
+func (m NotificationModel) Set(userID int64, prefs NotificationPreferences) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, kind, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, kind) DO UPDATE
+		SET enabled = EXCLUDED.enabled
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for kind, enabled := range prefs {
+		_, err = tx.ExecContext(ctx, query, userID, kind, enabled)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetInbox() returns a page of the user's in-app notifications, newest first.
+// When unread is true the ones already read are left out.
+func (m NotificationModel) GetInbox(userID int64, unread bool, filters Filters) ([]*Notification, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), id, created_on, coltech_id, COALESCE(actor_id, 0),
+		kind, message, read_on
+		FROM notifications
+		WHERE user_id = $1
+		AND (read_on IS NULL OR NOT $2)
+		ORDER BY created_on DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, unread, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	notifications := []*Notification{}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(
+			&totalRecords,
+			&notification.ID,
+			&notification.Created_on,
+			&notification.Coltech_id,
+			&notification.Actor_id,
+			&notification.Kind,
+			&notification.Message,
+			&notification.Read_on,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		notifications = append(notifications, &notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return notifications, metadata, nil
+}
+
+// MarkRead() marks one of the user's notifications read, marking it again
+// keeps the time it was first read
+func (m NotificationModel) MarkRead(id int64, userID int64) (*Notification, error) {
+	query := `
+		UPDATE notifications
+		SET read_on = COALESCE(read_on, NOW())
+		WHERE id = $1
+		AND user_id = $2
+		RETURNING id, created_on, coltech_id, COALESCE(actor_id, 0), kind, message, read_on
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var notification Notification
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&notification.ID,
+		&notification.Created_on,
+		&notification.Coltech_id,
+		&notification.Actor_id,
+		&notification.Kind,
+		&notification.Message,
+		&notification.Read_on,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &notification, nil
+}
@@ -27,15 +27,60 @@ type PermissionModel struct {
 	DB *sql.DB
 }
 
+// GetAll() returns every permission code, for admins choosing what to grant
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		ORDER BY code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanPermissions(rows)
+}
+
+// GetAllForUser() returns the user's effective permissions, the ones granted
+// to them directly together with the ones of each of their roles
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		WHERE permissions.id IN (
+			SELECT permission_id
+			FROM users_permissions
+			WHERE user_id = $1
+			UNION
+			SELECT roles_permissions.permission_id
+			FROM users_roles
+			INNER JOIN roles_permissions
+			ON roles_permissions.role_id = users_roles.role_id
+			WHERE users_roles.user_id = $1
+		)
+		ORDER BY permissions.code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPermissions(rows)
+}
+
+// GetDirectForUser() returns only the permissions granted to the user
+// directly rather than through a role
+func (m PermissionModel) GetDirectForUser(userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
 		INNER JOIN users_permissions
 		ON users_permissions.permission_id = permissions.id
-		INNER JOIN tblusers
-		ON users_permissions.user_id = tblusers.id
-		WHERE tblusers.id = $1
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -43,9 +88,14 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	if err != nil {
 		return nil, err
 	}
+	return scanPermissions(rows)
+}
+
+// scanPermissions() reads a column of permission codes and closes the rows
+func scanPermissions(rows *sql.Rows) (Permissions, error) {
 	defer rows.Close()
 
-	var permissions Permissions
+	permissions := Permissions{}
 	for rows.Next() {
 		var permission string
 		err := rows.Scan(&permission)
@@ -54,16 +104,19 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 		}
 		permissions = append(permissions, permission)
 	}
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return permissions, nil
 }
 
+// AddForUser() grants the permissions to the user directly, ones they
+// already have are left alone
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
 		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -71,3 +124,28 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// RemoveForUser() takes back a permission granted to the user directly. The
+// user keeps it if one of their roles has it.
+func (m PermissionModel) RemoveForUser(userID int64, code string) error {
+	query := `
+		DELETE FROM users_permissions
+		WHERE user_id = $1
+		AND permission_id = (SELECT id FROM permissions WHERE code = $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Filename: internal/data/priorities.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// The levels impact and urgency are rated on
+const (
+	LevelHigh   = "HIGH"
+	LevelMedium = "MEDIUM"
+	LevelLow    = "LOW"
+)
+
+// Levels lists every level of impact and urgency
+var Levels = []string{LevelHigh, LevelMedium, LevelLow}
+
+// A PriorityCell is the priority the matrix gives one combination of impact
+// and urgency
+type PriorityCell struct {
+	Impact       string `json:"impact"`
+	Urgency      string `json:"urgency"`
+	Priority_val string `json:"priority_val"`
+}
+
+// A PriorityMatrix derives a coltech item's priority from its impact and urgency
+type PriorityMatrix []*PriorityCell
+
+// Priority() returns the priority for the impact and urgency, MEDIUM when the
+// matrix has no cell for them
+func (pm PriorityMatrix) Priority(impact, urgency string) string {
+	for _, cell := range pm {
+		if cell.Impact == impact && cell.Urgency == urgency {
+			return cell.Priority_val
+		}
+	}
+	return LevelMedium
+}
+
+// Apply() fills in a missing impact or urgency and sets the coltech item's
+// priority from the matrix. A priority with a reason was set by an agent, a
+// template or a macro and is kept.
+func (pm PriorityMatrix) Apply(coltech *Coltech) {
+	if coltech.Impact == "" {
+		coltech.Impact = LevelMedium
+	}
+	if coltech.Urgency == "" {
+		coltech.Urgency = LevelMedium
+	}
+	if coltech.Priority_reason == "" {
+		coltech.Priority_val = pm.Priority(coltech.Impact, coltech.Urgency)
+	}
+}
+
+func ValidatePriorityMatrix(v *validator.Validator, cells PriorityMatrix) {
+	v.Check(len(cells) != 0, "matrix", "must be provided")
+	seen := make(map[[2]string]bool, len(cells))
+	for _, cell := range cells {
+		v.Check(validator.In(cell.Impact, Levels...), "impact", "must be HIGH, MEDIUM or LOW")
+		v.Check(validator.In(cell.Urgency, Levels...), "urgency", "must be HIGH, MEDIUM or LOW")
+		v.Check(cell.Priority_val != "", "priority_val", "must be provided")
+		v.Check(len(cell.Priority_val) <= 50, "priority_val", "must not be more than 50 bytes long")
+		v.Check(!seen[[2]string{cell.Impact, cell.Urgency}], "matrix", "must not contain the same impact and urgency twice")
+		seen[[2]string{cell.Impact, cell.Urgency}] = true
+	}
+}
+
+// Define a PriorityMatrixModel which wraps a sql.DB connection pool
+type PriorityMatrixModel struct {
+	DB *sql.DB
+}
+
+// Get() returns the matrix, highest impact and urgency first
+func (m PriorityMatrixModel) Get() (PriorityMatrix, error) {
+	query := `
+		SELECT impact, urgency, priority_val
+		FROM priority_matrix
+		ORDER BY array_position(ARRAY['HIGH', 'MEDIUM', 'LOW'], impact),
+		array_position(ARRAY['HIGH', 'MEDIUM', 'LOW'], urgency)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matrix := PriorityMatrix{}
+	for rows.Next() {
+		var cell PriorityCell
+		err := rows.Scan(&cell.Impact, &cell.Urgency, &cell.Priority_val)
+		if err != nil {
+			return nil, err
+		}
+		matrix = append(matrix, &cell)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return matrix, nil
+}
+
+// Set() saves the given cells, cells that are left out keep their priority.
+// Coltech items keep the priority they have until they are next updated.
+func (m PriorityMatrixModel) Set(cells PriorityMatrix) error {
+	query := `
+		INSERT INTO priority_matrix (impact, urgency, priority_val)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (impact, urgency) DO UPDATE
+		SET priority_val = EXCLUDED.priority_val
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, cell := range cells {
+		_, err = tx.ExecContext(ctx, query, cell.Impact, cell.Urgency, cell.Priority_val)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
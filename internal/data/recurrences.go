@@ -0,0 +1,317 @@
+// Filename: internal/data/recurrences.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"coltech.osborncollins.net/internal/schedule"
+	"coltech.osborncollins.net/internal/validator"
+)
+
+var (
+	ErrOccurrenceClaimed = errors.New("occurrence already claimed")
+)
+
+// A Recurrence creates a coltech item from a template every time its
+// cron style schedule fires
+type Recurrence struct {
+	ID          int64     `json:"id"`
+	Created_on  time.Time `json:"created_on"`
+	Name        string    `json:"name"`
+	Schedule    string    `json:"schedule"`
+	Template_id int64     `json:"template_id"`
+	Assigned_to string    `json:"assigned_to"`
+	Created_by  string    `json:"created_by"`
+	Enabled     bool      `json:"enabled"`
+	Next_run    time.Time `json:"next_run"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateRecurrence(v *validator.Validator, rec *Recurrence) {
+	// Name validation
+	v.Check(rec.Name != "", "name", "must be provided")
+	v.Check(len(rec.Name) <= 200, "name", "must not be more than 200 bytes long")
+	// Schedule validation
+	v.Check(rec.Schedule != "", "schedule", "must be provided")
+	if rec.Schedule != "" {
+		sched, err := schedule.Parse(rec.Schedule)
+		if err != nil {
+			v.AddError("schedule", err.Error())
+		} else {
+			v.Check(!sched.Next(time.Now()).IsZero(), "schedule", "must run at least once in the next five years")
+		}
+	}
+	// Template validation
+	v.Check(rec.Template_id > 0, "template_id", "must be provided")
+	// An empty assignee leaves it to the department's assignment rule
+	v.Check(len(rec.Assigned_to) <= 300, "assigned_to", "must not be more than 300 bytes long")
+	// Created_by validation
+	v.Check(rec.Created_by != "", "created_by", "must be provided")
+	v.Check(len(rec.Created_by) <= 300, "created_by", "must not be more than 300 bytes long")
+}
+
+// Define a RecurrenceModel which wraps a sql.DB connection pool
+type RecurrenceModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new recurrence
+func (m RecurrenceModel) Insert(rec *Recurrence) error {
+	query := `
+		INSERT INTO recurrences (name, schedule, template_id, assigned_to, created_by, enabled, next_run)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{
+		rec.Name,
+		rec.Schedule,
+		rec.Template_id,
+		rec.Assigned_to,
+		rec.Created_by,
+		rec.Enabled,
+		rec.Next_run,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&rec.ID, &rec.Created_on, &rec.Version)
+}
+
+// Get() allows us to retrieve a specific recurrence
+func (m RecurrenceModel) Get(id int64) (*Recurrence, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, name, schedule, template_id, assigned_to, created_by, enabled, next_run, version
+		FROM recurrences
+		WHERE id = $1
+	`
+	var rec Recurrence
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&rec.ID,
+		&rec.Created_on,
+		&rec.Name,
+		&rec.Schedule,
+		&rec.Template_id,
+		&rec.Assigned_to,
+		&rec.Created_by,
+		&rec.Enabled,
+		&rec.Next_run,
+		&rec.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+// GetAll() returns every recurrence sorted by name
+func (m RecurrenceModel) GetAll() ([]*Recurrence, error) {
+	query := `
+		SELECT id, created_on, name, schedule, template_id, assigned_to, created_by, enabled, next_run, version
+		FROM recurrences
+		ORDER BY name, id
+	`
+	return m.query(query)
+}
+
+// GetDue() returns the enabled recurrences whose next run has come around
+func (m RecurrenceModel) GetDue() ([]*Recurrence, error) {
+	query := `
+		SELECT id, created_on, name, schedule, template_id, assigned_to, created_by, enabled, next_run, version
+		FROM recurrences
+		WHERE enabled AND next_run <= NOW()
+		ORDER BY next_run, id
+	`
+	return m.query(query)
+}
+
+// query() runs a recurrence listing query
+func (m RecurrenceModel) query(query string) ([]*Recurrence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recs := []*Recurrence{}
+	for rows.Next() {
+		var rec Recurrence
+		err := rows.Scan(
+			&rec.ID,
+			&rec.Created_on,
+			&rec.Name,
+			&rec.Schedule,
+			&rec.Template_id,
+			&rec.Assigned_to,
+			&rec.Created_by,
+			&rec.Enabled,
+			&rec.Next_run,
+			&rec.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, &rec)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// Update() allows us to edit a recurrence
+func (m RecurrenceModel) Update(rec *Recurrence) error {
+	query := `
+		UPDATE recurrences
+		SET name = $2, schedule = $3, template_id = $4, assigned_to = $5,
+		created_by = $6, enabled = $7, next_run = $8, version = version + 1
+		WHERE id = $1
+		AND version = $9
+		RETURNING version
+	`
+	args := []interface{}{
+		rec.ID,
+		rec.Name,
+		rec.Schedule,
+		rec.Template_id,
+		rec.Assigned_to,
+		rec.Created_by,
+		rec.Enabled,
+		rec.Next_run,
+		rec.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&rec.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific recurrence
+func (m RecurrenceModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM recurrences
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Run() claims the recurrence's current occurrence, creates the coltech item
+// (when coltech is not nil) along with the approvals its category's steps
+// call for, and moves next_run on, all in one transaction. When another
+// instance has already claimed the occurrence nothing is created and
+// ErrOccurrenceClaimed is returned.
+func (m RecurrenceModel) Run(rec *Recurrence, coltech *Coltech, steps []*ApprovalStep, next time.Time) ([]*Approval, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A second instance blocks here until the first commits, then inserts nothing
+	query := `
+		INSERT INTO recurrence_runs (recurrence_id, occurrence)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	results, err := tx.ExecContext(ctx, query, rec.ID, rec.Next_run)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrOccurrenceClaimed
+	}
+
+	var approvals []*Approval
+	if coltech != nil {
+		// Coltech items that need approval wait for it before work starts
+		if len(steps) > 0 {
+			coltech.Status_val = StatusAwaitingApproval
+		}
+		err = insertColtech(ctx, tx, coltech)
+		if err != nil {
+			return nil, err
+		}
+		approvals, err = insertApprovals(ctx, tx, coltech, steps)
+		if err != nil {
+			return nil, err
+		}
+		err = insertEvent(ctx, tx, &Event{Type: EventCreated, Coltech: coltech})
+		if err != nil {
+			return nil, err
+		}
+		query = `
+			UPDATE recurrence_runs
+			SET coltech_id = $3
+			WHERE recurrence_id = $1 AND occurrence = $2
+		`
+		_, err = tx.ExecContext(ctx, query, rec.ID, rec.Next_run, coltech.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A schedule that will never fire again is switched off
+	query = `
+		UPDATE recurrences
+		SET next_run = $3, enabled = $4
+		WHERE id = $1 AND next_run = $2
+	`
+	_, err = tx.ExecContext(ctx, query, rec.ID, rec.Next_run, next, !next.IsZero())
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
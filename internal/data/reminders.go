@@ -0,0 +1,100 @@
+// Filename: internal/data/reminders.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ReminderOverdue is the kind recorded for the notice sent once a coltech item
+// is past its due date, reminders before it are recorded as "due_in_" and the
+// lead time
+const ReminderOverdue = "overdue"
+
+// Define a ReminderModel which wraps a sql.DB connection pool
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// GetDue() returns the open, assigned coltech items that are due within the
+// horizon or are overdue without an overdue notice, soonest first
+func (m ReminderModel) GetDue(horizon time.Duration) ([]*Coltech, error) {
+	sel := selectColtech([]string{"summary", "status_val", "assigned_to", "department", "due_on"})
+	query := `
+		SELECT ` + sel.list() + `
+		FROM tblcoltech
+		WHERE status_val <> $1
+		AND assigned_to NOT IN ('', $2)
+		AND due_on > '0001-01-02'
+		AND due_on <= $3
+		AND NOT EXISTS (
+			SELECT 1 FROM due_reminders
+			WHERE due_reminders.coltech_id = tblcoltech.id
+			AND due_reminders.kind = $4
+			AND due_reminders.due_on = tblcoltech.due_on
+		)
+		ORDER BY due_on, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	args := []interface{}{StatusClosed, Unassigned, time.Now().Add(horizon), ReminderOverdue}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coltechs := []*Coltech{}
+	for rows.Next() {
+		var coltech Coltech
+		err := rows.Scan(sel.dest(&coltech)...)
+		if err != nil {
+			return nil, err
+		}
+		coltechs = append(coltechs, &coltech)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return coltechs, nil
+}
+
+// Claim() records that the reminder is being sent and reports whether this
+// call recorded it. Only the instance that records it sends the email, and
+// nothing is sent twice for the same due date after a restart.
+func (m ReminderModel) Claim(coltechID int64, kind string, dueOn time.Time) (bool, error) {
+	query := `
+		INSERT INTO due_reminders (coltech_id, kind, due_on)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, coltechID, kind, dueOn)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Release() takes back a claim so that a reminder that could not be sent is
+// tried again on the next run
+func (m ReminderModel) Release(coltechID int64, kind string, dueOn time.Time) error {
+	query := `
+		DELETE FROM due_reminders
+		WHERE coltech_id = $1 AND kind = $2 AND due_on = $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, coltechID, kind, dueOn)
+	return err
+}
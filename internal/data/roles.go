@@ -0,0 +1,221 @@
+// Filename: internal/data/roles.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// The roles every installation starts with
+const (
+	RoleRequester  = "requester"
+	RoleAgent      = "agent"
+	RoleSupervisor = "supervisor"
+	RoleAdmin      = "admin"
+)
+
+var (
+	ErrDuplicateRole = errors.New("duplicate role")
+	// Role names are used in URLs so they are kept to lower case words
+	RoleNameRx = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// A Role bundles permission codes so that they can be granted together
+type Role struct {
+	ID          int64       `json:"id"`
+	Created_on  time.Time   `json:"created_on"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+}
+
+func ValidateRole(v *validator.Validator, role *Role, known Permissions) {
+	// Name validation
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(role.Name, RoleNameRx), "name", "must be lower case letters, digits and underscores")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 bytes long")
+	// Permissions validation
+	v.Check(len(role.Permissions) > 0, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range role.Permissions {
+		v.Check(known.Include(code), "permissions", "must only contain existing permission codes")
+	}
+}
+
+// Define a RoleModel which wraps a sql.DB connection pool
+type RoleModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds a role along with its permissions
+func (m RoleModel) Insert(role *Role) error {
+	query := `
+		INSERT INTO roles (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_on
+	`
+	permissionsQuery := `
+		INSERT INTO roles_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE code = ANY($2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description).Scan(&role.ID, &role.Created_on)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, permissionsQuery, role.ID, pq.Array([]string(role.Permissions)))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// roleQuery selects roles with their permission codes gathered into an array
+const roleQuery = `
+	SELECT roles.id, roles.created_on, roles.name, roles.description,
+	COALESCE(array_agg(permissions.code ORDER BY permissions.code)
+		FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM roles
+	LEFT JOIN roles_permissions
+	ON roles_permissions.role_id = roles.id
+	LEFT JOIN permissions
+	ON permissions.id = roles_permissions.permission_id
+`
+
+// Get() returns the role with the name
+func (m RoleModel) Get(name string) (*Role, error) {
+	query := roleQuery + `
+		WHERE roles.name = $1
+		GROUP BY roles.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role Role
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(
+		&role.ID,
+		&role.Created_on,
+		&role.Name,
+		&role.Description,
+		pq.Array((*[]string)(&role.Permissions)),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &role, nil
+}
+
+// GetAll() returns every role
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := roleQuery + `
+		GROUP BY roles.id
+		ORDER BY roles.id
+	`
+	return m.getAll(query)
+}
+
+// GetAllForUser() returns the roles the user has
+func (m RoleModel) GetAllForUser(userID int64) ([]*Role, error) {
+	query := roleQuery + `
+		WHERE roles.id IN (SELECT role_id FROM users_roles WHERE user_id = $1)
+		GROUP BY roles.id
+		ORDER BY roles.id
+	`
+	return m.getAll(query, userID)
+}
+
+func (m RoleModel) getAll(query string, args ...interface{}) ([]*Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(
+			&role.ID,
+			&role.Created_on,
+			&role.Name,
+			&role.Description,
+			pq.Array((*[]string)(&role.Permissions)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// AddForUser() gives the user the named roles, ones they already have are
+// left alone
+func (m RoleModel) AddForUser(userID int64, names ...string) error {
+	query := `
+		INSERT INTO users_roles (user_id, role_id)
+		SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2::citext[])
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+// RemoveForUser() takes the named role away from the user
+func (m RoleModel) RemoveForUser(userID int64, name string) error {
+	query := `
+		DELETE FROM users_roles
+		WHERE user_id = $1
+		AND role_id = (SELECT id FROM roles WHERE name = $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
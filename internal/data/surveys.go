@@ -0,0 +1,225 @@
+// Filename: internal/data/surveys.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// A Survey asks the requester of a closed coltech item to rate the service
+type Survey struct {
+	ID           int64      `json:"id"`
+	Created_on   time.Time  `json:"created_on"`
+	Coltech_id   int64      `json:"coltech_id"`
+	Summary      string     `json:"summary"`
+	User_id      int64      `json:"-"`
+	Token_hash   []byte     `json:"-"`
+	Assigned_to  string     `json:"assigned_to"`
+	Department   string     `json:"department"`
+	Rating       int        `json:"rating,omitempty"`
+	Comment      string     `json:"comment,omitempty"`
+	Responded_on *time.Time `json:"responded_on,omitempty"`
+}
+
+func ValidateSurveyResponse(v *validator.Validator, survey *Survey) {
+	v.Check(survey.Rating >= 1 && survey.Rating <= 5, "rating", "must be between 1 and 5")
+	v.Check(len(survey.Comment) <= 1000, "comment", "must not be more than 1000 bytes long")
+}
+
+// Define a SurveyModel which wraps a sql.DB connection pool
+type SurveyModel struct {
+	DB *sql.DB
+}
+
+// Insert() records that a survey was sent for a closed coltech item
+func (m SurveyModel) Insert(survey *Survey) error {
+	query := `
+		INSERT INTO surveys (coltech_id, user_id, token_hash, assigned_to, department)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_on
+	`
+	args := []interface{}{
+		survey.Coltech_id,
+		survey.User_id,
+		survey.Token_hash,
+		survey.Assigned_to,
+		survey.Department,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&survey.ID, &survey.Created_on)
+}
+
+// GetForToken() returns the unanswered survey for a survey scoped token that has not expired
+func (m SurveyModel) GetForToken(tokenPlaintext string) (*Survey, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		SELECT surveys.id, surveys.created_on, surveys.coltech_id, tblcoltech.summary,
+		surveys.user_id, surveys.token_hash, surveys.assigned_to, surveys.department
+		FROM surveys
+		INNER JOIN tokens
+		ON surveys.token_hash = tokens.hash
+		INNER JOIN tblcoltech
+		ON surveys.coltech_id = tblcoltech.id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND surveys.responded_on IS NULL
+	`
+	args := []interface{}{tokenHash[:], ScopeSurvey, time.Now()}
+	var survey Survey
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&survey.ID,
+		&survey.Created_on,
+		&survey.Coltech_id,
+		&survey.Summary,
+		&survey.User_id,
+		&survey.Token_hash,
+		&survey.Assigned_to,
+		&survey.Department,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &survey, nil
+}
+
+// Respond() saves the rating and comment and deletes the token so the
+// survey link only works once
+func (m SurveyModel) Respond(survey *Survey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE surveys
+		SET rating = $2, comment = $3, responded_on = NOW()
+		WHERE id = $1 AND responded_on IS NULL
+		RETURNING responded_on
+	`
+	var respondedOn time.Time
+	err = tx.QueryRowContext(ctx, query, survey.ID, survey.Rating, survey.Comment).Scan(&respondedOn)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	query = `
+		DELETE FROM tokens
+		WHERE hash = $1
+	`
+	_, err = tx.ExecContext(ctx, query, survey.Token_hash)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	survey.Responded_on = &respondedOn
+	return nil
+}
+
+// A SatisfactionScore summarises the survey results for a technician or department
+type SatisfactionScore struct {
+	Name           string  `json:"name"`
+	Surveys_sent   int     `json:"surveys_sent"`
+	Responses      int     `json:"responses"`
+	Average_rating float64 `json:"average_rating"`
+	Satisfied      int     `json:"satisfied"`
+}
+
+// SatisfactionStats holds the CSAT figures for surveys sent in a date range
+type SatisfactionStats struct {
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Overall     *SatisfactionScore   `json:"overall"`
+	Technicians []*SatisfactionScore `json:"technicians"`
+	Departments []*SatisfactionScore `json:"departments"`
+}
+
+// Stats() works out the satisfaction scores for surveys sent between from
+// (inclusive) and to (exclusive). A rating of 4 or 5 counts as satisfied.
+func (m SurveyModel) Stats(from, to time.Time) (*SatisfactionStats, error) {
+	stats := &SatisfactionStats{From: from, To: to}
+	overall, err := m.scoreBy("'all'", from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats.Overall = &SatisfactionScore{Name: "all"}
+	if len(overall) > 0 {
+		stats.Overall = overall[0]
+	}
+	// The grouping columns are fixed here and never come from the client
+	stats.Technicians, err = m.scoreBy("assigned_to", from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats.Departments, err = m.scoreBy("department", from, to)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// scoreBy() totals the surveys in a date range grouped by the given column
+func (m SurveyModel) scoreBy(column string, from, to time.Time) ([]*SatisfactionScore, error) {
+	query := `
+		SELECT ` + column + `, COUNT(*), COUNT(rating),
+		COALESCE(ROUND(AVG(rating), 2), 0), COUNT(*) FILTER (WHERE rating >= 4)
+		FROM surveys
+		WHERE created_on >= $1
+		AND created_on < $2
+		GROUP BY 1
+		ORDER BY 1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := []*SatisfactionScore{}
+	for rows.Next() {
+		var score SatisfactionScore
+		err := rows.Scan(
+			&score.Name,
+			&score.Surveys_sent,
+			&score.Responses,
+			&score.Average_rating,
+			&score.Satisfied,
+		)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, &score)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
@@ -0,0 +1,296 @@
+// Filename: internal/data/templates.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateTemplate = errors.New("duplicate ticket template")
+	// Template names are used in the ?template= query parameter
+	TemplateNameRx = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+)
+
+// A Template holds the defaults for a common type of coltech item
+type Template struct {
+	ID            int64        `json:"id"`
+	Created_on    time.Time    `json:"created_on"`
+	Name          string       `json:"name"`
+	Summary       string       `json:"summary"`
+	Description   string       `json:"description"`
+	Category      string       `json:"category"`
+	Department    string       `json:"department"`
+	Priority_val  string       `json:"priority_val"`
+	Tags          []string     `json:"tags"`
+	Custom_fields CustomValues `json:"custom_fields"`
+	Version       int32        `json:"version"`
+}
+
+func ValidateTemplate(v *validator.Validator, template *Template, fields []*CustomField) {
+	// Name validation
+	v.Check(template.Name != "", "name", "must be provided")
+	v.Check(validator.Matches(template.Name, TemplateNameRx), "name", "must only contain lowercase letters, digits and hyphens")
+	// The defaults are all optional but must fit in a coltech item
+	v.Check(len(template.Summary) <= 300, "summary", "must not be more than 300 bytes long")
+	v.Check(len(template.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(len(template.Category) <= 200, "category", "must not be more than 200 bytes long")
+	v.Check(len(template.Department) <= 200, "department", "must not be more than 200 bytes long")
+	v.Check(len(template.Priority_val) <= 50, "priority_val", "must not be more than 50 bytes long")
+	v.Check(len(template.Tags) <= 20, "tags", "must not contain more than 20 tags")
+	v.Check(validator.Unique(template.Tags), "tags", "must not contain duplicate values")
+	// Custom fields only make sense once we know the category
+	v.Check(len(template.Custom_fields) == 0 || template.Category != "", "custom_fields", "must only be provided with a category")
+	// Check the value types but leave required fields for the client to fill in
+	optional := make([]*CustomField, len(fields))
+	for i, field := range fields {
+		relaxed := *field
+		relaxed.Required = false
+		optional[i] = &relaxed
+	}
+	ValidateCustomValues(v, template.Custom_fields, optional)
+}
+
+// Apply() fills in the coltech item's empty fields from the template. Tags are
+// combined and the client's custom field values win over the template's.
+func (t *Template) Apply(coltech *Coltech) {
+	if coltech.Summary == "" {
+		coltech.Summary = t.Summary
+	}
+	if coltech.Description == "" {
+		coltech.Description = t.Description
+	}
+	if coltech.Category == "" {
+		coltech.Category = t.Category
+	}
+	if coltech.Department == "" {
+		coltech.Department = t.Department
+	}
+	// The template's priority overrides the matrix
+	if coltech.Priority_val == "" && t.Priority_val != "" {
+		coltech.Priority_val = t.Priority_val
+		coltech.Priority_reason = "template:" + t.Name
+	}
+	for _, tag := range t.Tags {
+		if !validator.In(tag, coltech.Tags...) {
+			coltech.Tags = append(coltech.Tags, tag)
+		}
+	}
+	values := make(CustomValues, len(t.Custom_fields)+len(coltech.Custom_fields))
+	for name, value := range t.Custom_fields {
+		values[name] = value
+	}
+	for name, value := range coltech.Custom_fields {
+		values[name] = value
+	}
+	coltech.Custom_fields = values
+}
+
+// Define a TemplateModel which wraps a sql.DB connection pool
+type TemplateModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new ticket template
+func (m TemplateModel) Insert(template *Template) error {
+	query := `
+		INSERT INTO ticket_templates (name, summary, description, category, department, priority_val, tags, custom_fields)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::text[], '{}'), $8)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{
+		template.Name,
+		template.Summary,
+		template.Description,
+		template.Category,
+		template.Department,
+		template.Priority_val,
+		pq.Array(template.Tags),
+		template.Custom_fields,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&template.ID, &template.Created_on, &template.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateTemplate
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get() allows us to retrieve a specific ticket template
+func (m TemplateModel) Get(id int64) (*Template, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, name, summary, description, category, department, priority_val, tags, custom_fields, version
+		FROM ticket_templates
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanTemplate(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetByName() allows us to retrieve a ticket template by its name
+func (m TemplateModel) GetByName(name string) (*Template, error) {
+	query := `
+		SELECT id, created_on, name, summary, description, category, department, priority_val, tags, custom_fields, version
+		FROM ticket_templates
+		WHERE name = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanTemplate(m.DB.QueryRowContext(ctx, query, name))
+}
+
+// GetAll() returns every ticket template sorted by name
+func (m TemplateModel) GetAll() ([]*Template, error) {
+	query := `
+		SELECT id, created_on, name, summary, description, category, department, priority_val, tags, custom_fields, version
+		FROM ticket_templates
+		ORDER BY name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*Template{}
+	for rows.Next() {
+		var template Template
+		err := rows.Scan(
+			&template.ID,
+			&template.Created_on,
+			&template.Name,
+			&template.Summary,
+			&template.Description,
+			&template.Category,
+			&template.Department,
+			&template.Priority_val,
+			pq.Array(&template.Tags),
+			&template.Custom_fields,
+			&template.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, &template)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// Update() allows us to edit a ticket template
+func (m TemplateModel) Update(template *Template) error {
+	query := `
+		UPDATE ticket_templates
+		SET name = $2, summary = $3, description = $4, category = $5,
+		department = $6, priority_val = $7, tags = COALESCE($8::text[], '{}'),
+		custom_fields = $9, version = version + 1
+		WHERE id = $1
+		AND version = $10
+		RETURNING version
+	`
+	args := []interface{}{
+		template.ID,
+		template.Name,
+		template.Summary,
+		template.Description,
+		template.Category,
+		template.Department,
+		template.Priority_val,
+		pq.Array(template.Tags),
+		template.Custom_fields,
+		template.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&template.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case isUniqueViolation(err):
+			return ErrDuplicateTemplate
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a specific ticket template
+func (m TemplateModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM ticket_templates
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// scanTemplate() reads a ticket template from a single row result
+func scanTemplate(row *sql.Row) (*Template, error) {
+	var template Template
+	err := row.Scan(
+		&template.ID,
+		&template.Created_on,
+		&template.Name,
+		&template.Summary,
+		&template.Description,
+		&template.Category,
+		&template.Department,
+		&template.Priority_val,
+		pq.Array(&template.Tags),
+		&template.Custom_fields,
+		&template.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &template, nil
+}
@@ -17,6 +17,9 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeSurvey         = "survey"
+	ScopeApproval       = "approval"
+	ScopePasswordReset  = "password-reset"
 )
 
 // Define the token type
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -27,6 +28,7 @@ type User struct {
 	Email      string    `json:"email"`
 	Password   password  `json:"-"`
 	Activated  bool      `json:"activated"`
+	Available  bool      `json:"available"`
 	Version    int       `json:"-"`
 }
 
@@ -106,7 +108,7 @@ func (m UserModel) Insert(user *User) error {
 	query := `
 		INSERT INTO tblusers (name, email, password_hash, activated)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_on, version
+		RETURNING id, created_on, available, version
 	`
 	args := []interface{}{
 		user.Name,
@@ -117,7 +119,7 @@ func (m UserModel) Insert(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Created_on, &user.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Created_on, &user.Available, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraints "users_email_key"`:
@@ -132,7 +134,7 @@ func (m UserModel) Insert(user *User) error {
 // Get user based on their email
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_on, name, email, password_hash, activated, version
+		SELECT id, created_on, name, email, password_hash, activated, available, version
 		FROM tblUsers
 		WHERE email = $1
 	`
@@ -146,6 +148,81 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Available,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetAllByEmail() returns the users with any of the emails, used to embed
+// the assignees of a page of coltech items in one query
+func (m UserModel) GetAllByEmail(emails []string) ([]*User, error) {
+	query := `
+		SELECT id, created_on, name, email, activated, available, version
+		FROM tblusers
+		WHERE email = ANY($1::citext[])
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(emails))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Created_on,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Available,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Get user based on their id
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, name, email, password_hash, activated, available, version
+		FROM tblusers
+		WHERE id = $1
+	`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Created_on,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Available,
 		&user.Version,
 	)
 	if err != nil {
@@ -164,8 +241,8 @@ func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE tblusers
 		SET name = $1, email = $2, password_hash = $3,
-		activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		activated = $4, available = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version
 	`
 	args := []interface{}{
@@ -173,6 +250,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Available,
 		user.ID,
 		user.Version,
 	}
@@ -182,6 +260,8 @@ func (m UserModel) Update(user *User) error {
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
 		case err.Error() == `pq: duplicate key value violates unique constraints "users_email_key"`:
 			return ErrDuplicateEmail
 		default:
@@ -196,7 +276,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// Setup query
 	query := `
 		SELECT tblusers.id, tblusers.created_on, tblusers.name, tblusers.email, 
-		tblusers.password_hash, tblusers.activated, tblusers.version
+		tblusers.password_hash, tblusers.activated, tblusers.available, tblusers.version
 		FROM tblusers
 		INNER JOIN tokens
 		ON tblusers.id = tokens.user_id
@@ -216,6 +296,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Available,
 		&user.Version,
 	)
 	if err != nil {
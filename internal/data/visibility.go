@@ -0,0 +1,188 @@
+// Filename: internal/data/visibility.go
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The permissions that widen which coltech items a user can see. Without
+// either a user only sees the ones they raised, are assigned or watch.
+const (
+	PermissionReadAll        = "coltech_items:read_all"
+	PermissionReadDepartment = "coltech_items:read_department"
+)
+
+// A Viewer is the user a coltech item query is run for. Every ColtechModel
+// read takes one so that no endpoint can show coltech items the user may
+// not see.
+type Viewer struct {
+	UserID      int64
+	Email       string
+	All         bool
+	Departments []string
+}
+
+// NewViewer() works out what the user can see from their permissions and
+// the departments they work
+func NewViewer(user *User, permissions Permissions, departments []string) *Viewer {
+	viewer := &Viewer{
+		UserID:      user.ID,
+		Email:       user.Email,
+		All:         permissions.Include(PermissionReadAll),
+		Departments: []string{},
+	}
+	if permissions.Include(PermissionReadDepartment) {
+		viewer.Departments = departments
+	}
+	return viewer
+}
+
+// clause() returns the condition limiting tblcoltech to the coltech items the
+// viewer can see, numbering its placeholders from n, and the arguments for
+// them. Confidential coltech items are only seen by the people named on them,
+// not by supervisors or watchers.
+func (v *Viewer) clause(n int) (string, []interface{}) {
+	query := fmt.Sprintf(`(
+		(NOT tblcoltech.confidential AND (
+			$%[1]d
+			OR tblcoltech.department = ANY($%[2]d)
+			OR tblcoltech.id IN (SELECT coltech_id FROM watchers WHERE user_id = $%[3]d)
+		))
+		OR tblcoltech.requester_id = $%[3]d
+		OR lower(tblcoltech.assigned_to) = lower($%[4]d)
+		OR $%[3]d = ANY(tblcoltech.confidential_to)
+	)`, n, n+1, n+2, n+3)
+	args := []interface{}{v.All, pq.Array(v.Departments), v.UserID, v.Email}
+	return query, args
+}
+
+// CanSee() is the Go side of clause() for coltech items that have already
+// been loaded, such as the ones in events. Whether the viewer watches the
+// coltech item has to be looked up by the caller.
+func (v *Viewer) CanSee(coltech *Coltech, watching bool) bool {
+	if coltech.Requester_id == v.UserID || strings.EqualFold(coltech.Assigned_to, v.Email) {
+		return true
+	}
+	for _, id := range coltech.Confidential_to {
+		if id == v.UserID {
+			return true
+		}
+	}
+	if coltech.Confidential {
+		return false
+	}
+	if v.All || watching {
+		return true
+	}
+	for _, department := range v.Departments {
+		if department == coltech.Department {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWatchedIDs() returns the ids of the coltech items the user watches
+func (m ColtechModel) GetWatchedIDs(userID int64) (map[int64]bool, error) {
+	query := `
+		SELECT coltech_id
+		FROM watchers
+		WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watched := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		watched[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return watched, nil
+}
+
+// GetDepartments() returns the departments the user works, in name order
+func (m UserModel) GetDepartments(userID int64) ([]string, error) {
+	query := `
+		SELECT department
+		FROM users_departments
+		WHERE user_id = $1
+		ORDER BY department
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	departments := []string{}
+	for rows.Next() {
+		var department string
+		err := rows.Scan(&department)
+		if err != nil {
+			return nil, err
+		}
+		departments = append(departments, department)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return departments, nil
+}
+
+// SetDepartments() replaces the departments the user works
+func (m UserModel) SetDepartments(userID int64, departments []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_departments WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO users_departments (user_id, department)
+		SELECT $1, department FROM unnest($2::text[]) AS department
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(departments))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// uniqueIDs() is validator.Unique() for ids
+func uniqueIDs(ids []int64) bool {
+	seen := make(map[int64]bool)
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return len(ids) == len(seen)
+}
@@ -0,0 +1,537 @@
+// Filename: internal/data/webhooks.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+	"github.com/lib/pq"
+)
+
+// The states a webhook delivery moves through
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// EventTypes lists the event types a webhook can subscribe to
+var EventTypes = []string{EventCreated, EventUpdated, EventDeleted, EventCommented}
+
+// A Webhook posts coltech item events to a URL. The secret signs the payloads
+// and is only shown when the webhook is created.
+type Webhook struct {
+	ID          int64     `json:"id"`
+	Created_on  time.Time `json:"created_on"`
+	URL         string    `json:"url"`
+	Event_types []string  `json:"event_types"`
+	Secret      string    `json:"-"`
+	Enabled     bool      `json:"enabled"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	// URL validation
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+	if webhook.URL != "" {
+		u, err := url.Parse(webhook.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	}
+	// Event type validation, none means every event type
+	v.Check(validator.Unique(webhook.Event_types), "event_types", "must not contain duplicate values")
+	for _, eventType := range webhook.Event_types {
+		v.Check(validator.In(eventType, EventTypes...), "event_types", "must only contain created, updated, deleted or commented")
+	}
+	// Secret validation
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Secret) <= 200, "secret", "must not be more than 200 bytes long")
+}
+
+// A WebhookDelivery is one event queued for one webhook
+type WebhookDelivery struct {
+	ID               int64             `json:"id"`
+	Created_on       time.Time         `json:"created_on"`
+	Webhook_id       int64             `json:"webhook_id"`
+	Event_id         int64             `json:"event_id"`
+	Event_type       string            `json:"event_type"`
+	Payload          json.RawMessage   `json:"payload"`
+	Status           string            `json:"status"`
+	Attempts         int               `json:"attempts"`
+	Next_attempt     time.Time         `json:"next_attempt"`
+	Last_status_code int               `json:"last_status_code"`
+	Last_error       string            `json:"last_error"`
+	Delivered_on     *time.Time        `json:"delivered_on,omitempty"`
+	Attempt_log      []*WebhookAttempt `json:"attempt_log,omitempty"`
+	URL              string            `json:"-"`
+	Secret           string            `json:"-"`
+}
+
+// A WebhookAttempt records the outcome of one try at sending a delivery
+type WebhookAttempt struct {
+	ID          int64     `json:"id"`
+	Created_on  time.Time `json:"created_on"`
+	Status_code int       `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	Duration_ms int       `json:"duration_ms"`
+}
+
+// enqueueDeliveries() queues the event for every enabled webhook that wants it,
+// as part of the transaction that records the event
+func enqueueDeliveries(ctx context.Context, tx *sql.Tx, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3
+		FROM webhooks
+		WHERE enabled
+		AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`
+	_, err = tx.ExecContext(ctx, query, event.ID, event.Type, payload)
+	return err
+}
+
+// Define a WebhookModel which wraps a sql.DB connection pool
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new webhook
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (url, event_types, secret, enabled)
+		VALUES ($1, COALESCE($2::text[], '{}'), $3, $4)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{webhook.URL, pq.Array(webhook.Event_types), webhook.Secret, webhook.Enabled}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.Created_on, &webhook.Version)
+}
+
+// Get() allows us to retrieve a specific webhook
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, url, event_types, secret, enabled, version
+		FROM webhooks
+		WHERE id = $1
+	`
+	var webhook Webhook
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.ID,
+		&webhook.Created_on,
+		&webhook.URL,
+		pq.Array(&webhook.Event_types),
+		&webhook.Secret,
+		&webhook.Enabled,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+// GetAll() returns every webhook
+func (m WebhookModel) GetAll() ([]*Webhook, error) {
+	query := `
+		SELECT id, created_on, url, event_types, secret, enabled, version
+		FROM webhooks
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.Created_on,
+			&webhook.URL,
+			pq.Array(&webhook.Event_types),
+			&webhook.Secret,
+			&webhook.Enabled,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// Update() allows us to edit a webhook
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $2, event_types = COALESCE($3::text[], '{}'), secret = $4, enabled = $5,
+		version = version + 1
+		WHERE id = $1
+		AND version = $6
+		RETURNING version
+	`
+	args := []interface{}{
+		webhook.ID,
+		webhook.URL,
+		pq.Array(webhook.Event_types),
+		webhook.Secret,
+		webhook.Enabled,
+		webhook.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a webhook along with its queued deliveries
+func (m WebhookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// deliveryColumns are the webhook_deliveries columns scanned by scanDelivery()
+const deliveryColumns = `webhook_deliveries.id, webhook_deliveries.created_on, webhook_id, event_id,
+	event_type, payload, status, attempts, next_attempt, last_status_code, last_error, delivered_on`
+
+// scanDelivery() reads a delivery from a *sql.Row or *sql.Rows, followed by
+// any extra destinations
+func scanDelivery(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var deliveredOn sql.NullTime
+	dest := []interface{}{
+		&delivery.ID,
+		&delivery.Created_on,
+		&delivery.Webhook_id,
+		&delivery.Event_id,
+		&delivery.Event_type,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.Next_attempt,
+		&delivery.Last_status_code,
+		&delivery.Last_error,
+		&deliveredOn,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if deliveredOn.Valid {
+		delivery.Delivered_on = &deliveredOn.Time
+	}
+	return &delivery, nil
+}
+
+// GetDeliveries() returns a webhook's deliveries, newest first. An empty
+// status returns every delivery.
+func (m WebhookModel) GetDeliveries(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var total int
+		delivery, err := scanDelivery(prefixScanner{rows, &total})
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		totalRecords = total
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return deliveries, metadata, nil
+}
+
+// prefixScanner scans a leading column (such as COUNT(*) OVER()) before
+// handing the rest of the row to the wrapped scan
+type prefixScanner struct {
+	rows   *sql.Rows
+	prefix interface{}
+}
+
+func (p prefixScanner) Scan(dest ...interface{}) error {
+	return p.rows.Scan(append([]interface{}{p.prefix}, dest...)...)
+}
+
+// GetDelivery() returns a delivery belonging to a webhook with its attempts
+func (m WebhookModel) GetDelivery(webhookID, id int64) (*WebhookDelivery, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	delivery, err := scanDelivery(m.DB.QueryRowContext(ctx, query, id, webhookID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		SELECT id, created_on, status_code, error, duration_ms
+		FROM webhook_attempts
+		WHERE delivery_id = $1
+		ORDER BY id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivery.Attempt_log = []*WebhookAttempt{}
+	for rows.Next() {
+		var attempt WebhookAttempt
+		err := rows.Scan(&attempt.ID, &attempt.Created_on, &attempt.Status_code, &attempt.Error, &attempt.Duration_ms)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Attempt_log = append(delivery.Attempt_log, &attempt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ClaimDue() takes up to limit due deliveries for this instance. Claimed
+// deliveries have their next attempt pushed back by the lease so that no other
+// instance picks them up while they are being sent, and if this instance dies
+// they become due again once the lease runs out.
+func (m WebhookModel) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets several instances claim different deliveries at once
+	query := `
+		SELECT ` + deliveryColumns + `, webhooks.url, webhooks.secret
+		FROM webhook_deliveries
+		INNER JOIN webhooks
+		ON webhooks.id = webhook_deliveries.webhook_id
+		WHERE status = $1
+		AND next_attempt <= NOW()
+		AND webhooks.enabled
+		ORDER BY next_attempt, webhook_deliveries.id
+		LIMIT $2
+		FOR UPDATE OF webhook_deliveries SKIP LOCKED
+	`
+	rows, err := tx.QueryContext(ctx, query, DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []*WebhookDelivery{}
+	ids := []int64{}
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		delivery.URL = url
+		delivery.Secret = secret
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, delivery.ID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	query = `
+		UPDATE webhook_deliveries
+		SET next_attempt = $2
+		WHERE id = ANY($1)
+	`
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids), time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt() logs an attempt at sending a delivery and moves the delivery
+// on: delivered when err is nil, failed once maxAttempts is reached, otherwise
+// pending again at nextAttempt
+func (m WebhookModel) RecordAttempt(delivery *WebhookDelivery, statusCode int, sendErr error, duration time.Duration, maxAttempts int, nextAttempt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+	query := `
+		INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err = tx.ExecContext(ctx, query, delivery.ID, statusCode, errText, duration.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	delivery.Last_status_code = statusCode
+	delivery.Last_error = errText
+	delivery.Next_attempt = nextAttempt
+	switch {
+	case sendErr == nil:
+		delivery.Status = DeliveryDelivered
+		now := time.Now()
+		delivery.Delivered_on = &now
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = DeliveryFailed
+	default:
+		delivery.Status = DeliveryPending
+	}
+	query = `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt = $4, last_status_code = $5,
+		last_error = $6, delivered_on = $7
+		WHERE id = $1
+	`
+	args := []interface{}{
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.Next_attempt,
+		delivery.Last_status_code,
+		delivery.Last_error,
+		delivery.Delivered_on,
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Redeliver() queues a delivery to be sent again straight away with a fresh
+// set of attempts, whatever its current status
+func (m WebhookModel) Redeliver(webhookID, id int64) (*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $3, attempts = 0, next_attempt = NOW()
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING ` + deliveryColumns
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	delivery, err := scanDelivery(m.DB.QueryRowContext(ctx, query, id, webhookID, DeliveryPending))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return delivery, nil
+}
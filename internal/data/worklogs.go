@@ -0,0 +1,249 @@
+// Filename: internal/data/worklogs.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"coltech.osborncollins.net/internal/validator"
+)
+
+// A WorkLog records time a technician spent on a coltech item
+type WorkLog struct {
+	ID         int64     `json:"id"`
+	Created_on time.Time `json:"created_on"`
+	Coltech_id int64     `json:"coltech_id"`
+	User_id    int64     `json:"user_id"`
+	Started_on time.Time `json:"started_on"`
+	Duration   int       `json:"duration_minutes"`
+	Note       string    `json:"note"`
+	Billable   bool      `json:"billable"`
+	Version    int32     `json:"version"`
+}
+
+func ValidateWorkLog(v *validator.Validator, log *WorkLog) {
+	// Start time validation
+	v.Check(!log.Started_on.IsZero(), "started_on", "must be provided")
+	v.Check(log.Started_on.Before(time.Now().Add(time.Hour)), "started_on", "must not be in the future")
+	// Duration validation
+	v.Check(log.Duration > 0, "duration_minutes", "must be greater than zero")
+	v.Check(log.Duration <= 24*60, "duration_minutes", "must not be more than 24 hours")
+	// Note validation
+	v.Check(len(log.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+// Define a WorkLogModel which wraps a sql.DB connection pool
+type WorkLogModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds a work log entry to a coltech item
+func (m WorkLogModel) Insert(log *WorkLog) error {
+	query := `
+		INSERT INTO work_logs (coltech_id, user_id, started_on, duration_minutes, note, billable)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_on, version
+	`
+	args := []interface{}{
+		log.Coltech_id,
+		log.User_id,
+		log.Started_on,
+		log.Duration,
+		log.Note,
+		log.Billable,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&log.ID, &log.Created_on, &log.Version)
+}
+
+// Get() retrieves a work log entry belonging to a specific coltech item
+func (m WorkLogModel) Get(coltechID, id int64) (*WorkLog, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_on, coltech_id, user_id, started_on, duration_minutes, note, billable, version
+		FROM work_logs
+		WHERE id = $1 AND coltech_id = $2
+	`
+	var log WorkLog
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, coltechID).Scan(
+		&log.ID,
+		&log.Created_on,
+		&log.Coltech_id,
+		&log.User_id,
+		&log.Started_on,
+		&log.Duration,
+		&log.Note,
+		&log.Billable,
+		&log.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &log, nil
+}
+
+// GetAllForColtech() lists the work logged against a coltech item, oldest first
+func (m WorkLogModel) GetAllForColtech(coltechID int64) ([]*WorkLog, error) {
+	query := `
+		SELECT id, created_on, coltech_id, user_id, started_on, duration_minutes, note, billable, version
+		FROM work_logs
+		WHERE coltech_id = $1
+		ORDER BY started_on, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, coltechID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*WorkLog{}
+	for rows.Next() {
+		var log WorkLog
+		err := rows.Scan(
+			&log.ID,
+			&log.Created_on,
+			&log.Coltech_id,
+			&log.User_id,
+			&log.Started_on,
+			&log.Duration,
+			&log.Note,
+			&log.Billable,
+			&log.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, &log)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// Update() edits a work log entry
+func (m WorkLogModel) Update(log *WorkLog) error {
+	query := `
+		UPDATE work_logs
+		SET started_on = $2, duration_minutes = $3, note = $4, billable = $5,
+		version = version + 1
+		WHERE id = $1
+		AND version = $6
+		RETURNING version
+	`
+	args := []interface{}{
+		log.ID,
+		log.Started_on,
+		log.Duration,
+		log.Note,
+		log.Billable,
+		log.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&log.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// A WorkTimeTotal is the time logged against one department, category or technician
+type WorkTimeTotal struct {
+	Name             string `json:"name"`
+	Minutes          int64  `json:"minutes"`
+	Billable_minutes int64  `json:"billable_minutes"`
+}
+
+// A WorkTimeReport breaks down the time logged over a date range
+type WorkTimeReport struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Departments []*WorkTimeTotal `json:"departments"`
+	Categories  []*WorkTimeTotal `json:"categories"`
+	Technicians []*WorkTimeTotal `json:"technicians"`
+}
+
+// Report() sums the work started between from (inclusive) and to (exclusive)
+func (m WorkLogModel) Report(from, to time.Time) (*WorkTimeReport, error) {
+	report := &WorkTimeReport{From: from, To: to}
+	var err error
+	// The grouping columns are fixed here and never come from the client
+	report.Departments, err = m.sumBy("tblcoltech.department", from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.Categories, err = m.sumBy("tblcoltech.category", from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.Technicians, err = m.sumBy("tblusers.email", from, to)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// sumBy() totals the work logs in a date range grouped by the given column
+func (m WorkLogModel) sumBy(column string, from, to time.Time) ([]*WorkTimeTotal, error) {
+	query := fmt.Sprintf(`
+		SELECT %[1]s, SUM(work_logs.duration_minutes),
+		COALESCE(SUM(work_logs.duration_minutes) FILTER (WHERE work_logs.billable), 0)
+		FROM work_logs
+		INNER JOIN tblcoltech
+		ON work_logs.coltech_id = tblcoltech.id
+		INNER JOIN tblusers
+		ON work_logs.user_id = tblusers.id
+		WHERE work_logs.started_on >= $1
+		AND work_logs.started_on < $2
+		GROUP BY %[1]s
+		ORDER BY 2 DESC, 1 ASC`, column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []*WorkTimeTotal{}
+	for rows.Next() {
+		var total WorkTimeTotal
+		err := rows.Scan(&total.Name, &total.Minutes, &total.Billable_minutes)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, &total)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
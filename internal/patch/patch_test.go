@@ -0,0 +1,159 @@
+// Filename: internal/patch/patch_test.go
+
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// canonical() re-encodes a JSON document so that documents can be compared
+// regardless of member order and spacing
+func canonical(t *testing.T, js string) string {
+	t.Helper()
+	value, err := decode([]byte(js))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", js, err)
+	}
+	out, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("encoding %s: %v", js, err)
+	}
+	return string(out)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"set member", `{"a":1}`, `{"b":2}`, `{"a":1,"b":2}`},
+		{"replace member", `{"a":1}`, `{"a":"x"}`, `{"a":"x"}`},
+		{"null removes member", `{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{"null for missing member", `{"a":1}`, `{"z":null}`, `{"a":1}`},
+		{"nested objects merge", `{"a":{"b":1,"c":2}}`, `{"a":{"c":3,"d":4}}`, `{"a":{"b":1,"c":3,"d":4}}`},
+		{"nested null removes", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{"object replaces scalar", `{"a":1}`, `{"a":{"b":null,"c":2}}`, `{"a":{"c":2}}`},
+		{"arrays are replaced", `{"a":[1,2,3]}`, `{"a":[4]}`, `{"a":[4]}`},
+		{"non-object patch replaces", `{"a":1}`, `[1,2]`, `[1,2]`},
+		{"large numbers survive", `{"id":9007199254740993}`, `{}`, `{"id":9007199254740993}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), json.RawMessage(tt.patch))
+			if err != nil {
+				t.Fatalf("Merge() error: %v", err)
+			}
+			if string(got) != canonical(t, tt.want) {
+				t.Errorf("Merge() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		ops     string
+		want    string
+		wantErr error
+	}{
+		// add
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, nil},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`, nil},
+		{"add inserts into array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, nil},
+		{"add at array length", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`, nil},
+		{"add with - appends", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, nil},
+		{"add past array end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, "", ErrInvalidPatch},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, "", ErrInvalidPatch},
+		{"add without value", `{}`, `[{"op":"add","path":"/a"}]`, "", ErrInvalidPatch},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":{"b":2}}]`, `{"b":2}`, nil},
+		// array indexes
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/01","value":3}]`, "", ErrInvalidPatch},
+		{"zero index", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":3}]`, `{"a":[3,2]}`, nil},
+		{"negative index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/-1"}]`, "", ErrInvalidPatch},
+		{"signed index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/+1"}]`, "", ErrInvalidPatch},
+		{"negative zero index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/-0"}]`, "", ErrInvalidPatch},
+		{"index out of range", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/2","value":3}]`, "", ErrInvalidPatch},
+		{"- only for add", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/-"}]`, "", ErrInvalidPatch},
+		{"non-numeric index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/x"}]`, "", ErrInvalidPatch},
+		// remove and replace
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, nil},
+		{"remove array element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, nil},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, "", ErrInvalidPatch},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":null}]`, `{"a":null}`, nil},
+		{"replace missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", ErrInvalidPatch},
+		// pointer escaping
+		{"~1 is a slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`, nil},
+		{"~0 is a tilde", `{"a~b":1}`, `[{"op":"replace","path":"/a~0b","value":2}]`, `{"a~b":2}`, nil},
+		{"~01 is a tilde then 1", `{"a~1":1}`, `[{"op":"replace","path":"/a~01","value":2}]`, `{"a~1":2}`, nil},
+		{"path without slash", `{"a":1}`, `[{"op":"replace","path":"a","value":2}]`, "", ErrInvalidPatch},
+		// test
+		{"test matches", `{"a":"x"}`, `[{"op":"test","path":"/a","value":"x"}]`, `{"a":"x"}`, nil},
+		{"test differs", `{"a":"x"}`, `[{"op":"test","path":"/a","value":"y"}]`, "", ErrTestFailed},
+		{"test 1 equals 1.0", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`, nil},
+		{"test 1 equals 1e0", `{"a":1}`, `[{"op":"test","path":"/a","value":1e0}]`, `{"a":1}`, nil},
+		{"test number is not string", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, "", ErrTestFailed},
+		{"test objects ignore order", `{"a":{"x":1,"y":[1,2]}}`, `[{"op":"test","path":"/a","value":{"y":[1,2.0],"x":1}}]`, `{"a":{"x":1,"y":[1,2]}}`, nil},
+		{"test array order matters", `{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[2,1]}]`, "", ErrTestFailed},
+		{"test missing member", `{}`, `[{"op":"test","path":"/a","value":null}]`, "", ErrInvalidPatch},
+		// move and copy
+		{"move member", `{"a":1}`, `[{"op":"move","from":"/a","path":"/b"}]`, `{"b":1}`, nil},
+		{"move within array", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`, nil},
+		{"move into own child", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, "", ErrInvalidPatch},
+		{"move to itself", `{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":1}`, nil},
+		{"move to sibling prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`, nil},
+		{"move missing member", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`, "", ErrInvalidPatch},
+		{"copy member", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, nil},
+		{"copy is independent", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		// other
+		{"unknown op", `{}`, `[{"op":"frobnicate","path":"/a"}]`, "", ErrInvalidPatch},
+		{"operations in order", `{"a":[]}`, `[{"op":"add","path":"/a/-","value":1},{"op":"add","path":"/a/0","value":0},{"op":"test","path":"/a","value":[0,1]}]`, `{"a":[0,1]}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			err := json.Unmarshal([]byte(tt.ops), &ops)
+			if err != nil {
+				t.Fatalf("decoding ops: %v", err)
+			}
+			got, err := Apply([]byte(tt.doc), ops)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error: %v", err)
+			}
+			if string(got) != canonical(t, tt.want) {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFailureLeavesDocument(t *testing.T) {
+	doc := []byte(`{"a":[1,2],"b":{"c":1}}`)
+	before := string(doc)
+	ops := []Operation{
+		{Op: "add", Path: "/a/-", Value: json.RawMessage(`3`)},
+		{Op: "remove", Path: "/b/c"},
+		{Op: "test", Path: "/a/0", Value: json.RawMessage(`9`)},
+	}
+	got, err := Apply(doc, ops)
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("Apply() error = %v, want %v", err, ErrTestFailed)
+	}
+	if got != nil {
+		t.Errorf("Apply() = %s, want nil", got)
+	}
+	if string(doc) != before {
+		t.Errorf("document changed to %s, want %s", doc, before)
+	}
+}
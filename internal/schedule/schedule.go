@@ -0,0 +1,177 @@
+// Filename: internal/schedule/schedule.go
+
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule is a parsed five field cron expression:
+// minute hour day-of-month month day-of-week
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, when both day fields are restricted a day matches if
+	// either of them does
+	domStar, dowStar bool
+}
+
+// The bounds of each field
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var fields = []bounds{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Parse() reads a cron expression such as "0 6 1 * *" (06:00 on the first of
+// every month). Fields accept *, numbers, ranges (1-5), lists (1,15) and
+// steps (*/15 or 8-18/2). Day of week runs from 0 (Sunday) to 6.
+func Parse(expr string) (*Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, errors.New("must have five fields: minute hour day-of-month month day-of-week")
+	}
+	var masks [5]uint64
+	for i, part := range parts {
+		mask, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, err
+		}
+		masks[i] = mask
+	}
+	return &Schedule{
+		minute:  masks[0],
+		hour:    masks[1],
+		dom:     masks[2],
+		month:   masks[3],
+		dow:     masks[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+// parseField() turns one comma separated field into a bit mask of the values it allows
+func parseField(field string, b bounds) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(field, ",") {
+		// Split off the step
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s field %q", b.name, item)
+			}
+			step = n
+			item = item[:i]
+		}
+		// Work out the range
+		lo, hi := b.min, b.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			ends := strings.SplitN(item, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(ends[0])
+			hi, err2 = strconv.Atoi(ends[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range in %s field %q", b.name, item)
+			}
+		default:
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %s field %q", b.name, item)
+			}
+			lo, hi = n, n
+			// A single value with a step runs to the end of the field
+			if step > 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%s field must be between %d and %d", b.name, b.min, b.max)
+		}
+		for n := lo; n <= hi; n += step {
+			mask |= 1 << uint(n)
+		}
+	}
+	return mask, nil
+}
+
+// Next() returns the first time after t that the schedule fires. It returns
+// the zero time if nothing matches within five years (e.g. "0 0 30 2 *").
+// Times are matched on t's wall clock: one that is skipped when the clocks go
+// forward fires as soon as they have, and one that happens twice when they go
+// back fires only the first time.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	for {
+		wall = s.nextWall(wall)
+		if wall.IsZero() {
+			return time.Time{}
+		}
+		// time.Date() picks the first of a repeated time, which may be
+		// before t
+		next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+		if next.Hour() != wall.Hour() || next.Minute() != wall.Minute() {
+			// A skipped time may come out before the gap or after it, the
+			// one after it is the time moved on by the length of the gap
+			_, offset := next.Zone()
+			if other := wall.Add(-time.Duration(offset) * time.Second).In(loc); other.After(next) {
+				next = other
+			}
+		}
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// nextWall() returns the first minute after the wall clock time t, given in
+// UTC so that every day has 24 hours, that the schedule fires
+func (s *Schedule) nextWall(t time.Time) time.Time {
+	// Start from the next whole minute
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches() applies cron's rules for combining day of month and day of week
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,260 @@
+// Filename: internal/schedule/schedule_test.go
+
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 7",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) returned no error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Monday 1 January 2024
+	start := time.Date(2024, time.January, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			"every minute starts at the next whole minute", "* * * * *", start,
+			[]time.Time{
+				time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 9, 0, 0, time.UTC),
+			},
+		},
+		{
+			"a time on the minute is not repeated", "* * * * *", time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC),
+			[]time.Time{time.Date(2024, 1, 1, 10, 9, 0, 0, time.UTC)},
+		},
+		{
+			"step", "*/15 * * * *", start,
+			[]time.Time{
+				time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"value with a step runs to the end of the field", "50/5 * * * *", start,
+			[]time.Time{
+				time.Date(2024, 1, 1, 10, 50, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 55, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 11, 50, 0, 0, time.UTC),
+			},
+		},
+		{
+			"range with a step", "0 8-18/4 * * *", start,
+			[]time.Time{
+				time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 16, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"range", "0 9 * * 1-5", time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 9, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"list", "0 6 1,15 * *", start,
+			[]time.Time{
+				time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC),
+				time.Date(2024, 2, 1, 6, 0, 0, 0, time.UTC),
+				time.Date(2024, 2, 15, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"list of ranges", "0 0 * * 0,3-4", start,
+			[]time.Time{
+				time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// The 13th or any Friday, as cron does when both day fields are set
+			"day of month or day of week", "0 0 13 * 5", start,
+			[]time.Time{
+				time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"day of week alone", "0 0 * * 5", start,
+			[]time.Time{
+				time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"day of month alone", "0 0 13 * *", start,
+			[]time.Time{
+				time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 2, 13, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"month", "0 0 1 3,9 *", start,
+			[]time.Time{
+				time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"leap day", "0 0 29 2 *", start,
+			[]time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"31st skips short months", "0 0 31 * *", time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC),
+			[]time.Time{
+				time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 7, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+			}
+			from := tt.from
+			for _, want := range tt.want {
+				got := s.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%v) = %v, want %v", from, got, want)
+				}
+				from = got
+			}
+		})
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	for _, expr := range []string{"0 0 31 2 *", "0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		s, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", expr, err)
+		}
+		if got := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+			t.Errorf("Next() for %q = %v, want the zero time", expr, got)
+		}
+	}
+}
+
+func TestNextDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The clocks go forward from 02:00 to 03:00 on 10 March 2024 and back
+	// from 02:00 to 01:00 on 3 November 2024
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			"skipped time fires once the clocks have gone forward", "30 2 * * *",
+			time.Date(2024, 3, 9, 12, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2024, 3, 10, 3, 30, 0, 0, ny),
+				time.Date(2024, 3, 11, 2, 30, 0, 0, ny),
+			},
+		},
+		{
+			"time after the gap is unaffected", "0 9 * * *",
+			time.Date(2024, 3, 9, 12, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2024, 3, 10, 9, 0, 0, 0, ny),
+				time.Date(2024, 3, 11, 9, 0, 0, 0, ny),
+			},
+		},
+		{
+			"every 15 minutes across the gap", "*/15 * * * *",
+			time.Date(2024, 3, 10, 1, 40, 0, 0, ny),
+			[]time.Time{
+				time.Date(2024, 3, 10, 1, 45, 0, 0, ny),
+				time.Date(2024, 3, 10, 3, 0, 0, 0, ny),
+				time.Date(2024, 3, 10, 3, 15, 0, 0, ny),
+			},
+		},
+		{
+			"repeated time fires only the first time", "30 1 * * *",
+			time.Date(2024, 11, 2, 12, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC),
+				time.Date(2024, 11, 4, 6, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			"daily job after the change keeps its wall clock time", "0 9 * * *",
+			time.Date(2024, 11, 2, 12, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2024, 11, 3, 14, 0, 0, 0, time.UTC),
+				time.Date(2024, 11, 4, 14, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.expr, err)
+			}
+			from := tt.from
+			for _, want := range tt.want {
+				got := s.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%v) = %v, want %v", from, got, want)
+				}
+				from = got
+			}
+		})
+	}
+
+	// From the second 01:00-02:00 hour nothing more fires that night
+	s, _ := Parse("50 1 * * *")
+	from := time.Date(2024, 11, 3, 6, 10, 0, 0, time.UTC).In(ny) // 01:10 EST
+	want := time.Date(2024, 11, 4, 6, 50, 0, 0, time.UTC)
+	if got := s.Next(from); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+}
@@ -0,0 +1,112 @@
+// Filename: internal/webhook/webhook.go
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The headers sent with every delivery
+const (
+	HeaderEvent     = "X-Coltech-Event"
+	HeaderDelivery  = "X-Coltech-Delivery"
+	HeaderTimestamp = "X-Coltech-Timestamp"
+	HeaderSignature = "X-Coltech-Signature"
+)
+
+// NewSecret() returns a random secret for signing a webhook's payloads
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign() returns the signature header value for a payload. The timestamp is
+// signed along with the body so that receivers can reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify() reports whether the signature matches the payload. Receivers
+// written in Go can use it, and it documents the scheme for everyone else.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// A Delivery is one payload to be sent to one webhook
+type Delivery struct {
+	ID        int64
+	URL       string
+	Secret    string
+	EventType string
+	Payload   []byte
+}
+
+// Sender posts signed deliveries
+type Sender struct {
+	Client *http.Client
+}
+
+// New() returns a Sender whose requests give up after the timeout
+func New(timeout time.Duration) Sender {
+	return Sender{Client: &http.Client{Timeout: timeout}}
+}
+
+// Send() posts the delivery and returns the response status code. Any status
+// outside 2xx is returned as an error along with the code.
+func (s Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "coltech-webhooks")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff() returns how long to wait before the next attempt after the given
+// number of failed attempts: 30s, 1m, 2m, 4m ... capped at 6 hours
+func Backoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempts && wait < 6*time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > 6*time.Hour {
+		wait = 6 * time.Hour
+	}
+	return wait
+}
@@ -0,0 +1,121 @@
+// Filename: internal/webhook/webhook_test.go
+
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSendSigned(t *testing.T) {
+	d := Delivery{
+		ID:        42,
+		Secret:    "s3cret",
+		EventType: "coltech_item.created",
+		Payload:   []byte(`{"id":1}`),
+	}
+	received := make(chan bool, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading body: %v", err)
+		}
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Errorf("bad %s header: %v", HeaderTimestamp, err)
+		}
+		if !Verify(d.Secret, timestamp, body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("signature %q does not verify", r.Header.Get(HeaderSignature))
+		}
+		if Verify("wrong", timestamp, body, r.Header.Get(HeaderSignature)) {
+			t.Error("signature verifies with the wrong secret")
+		}
+		if got := r.Header.Get(HeaderEvent); got != d.EventType {
+			t.Errorf("%s = %q, want %q", HeaderEvent, got, d.EventType)
+		}
+		if got := r.Header.Get(HeaderDelivery); got != "42" {
+			t.Errorf("%s = %q, want %q", HeaderDelivery, got, "42")
+		}
+		if string(body) != string(d.Payload) {
+			t.Errorf("body = %q, want %q", body, d.Payload)
+		}
+		received <- true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	d.URL = ts.URL
+
+	status, err := New(5*time.Second).Send(context.Background(), d)
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", status, http.StatusNoContent)
+	}
+	select {
+	case <-received:
+	default:
+		t.Error("receiver was not called")
+	}
+}
+
+func TestSendNon2xx(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	status, err := New(5*time.Second).Send(context.Background(), Delivery{URL: ts.URL, Secret: "s"})
+	if err == nil {
+		t.Fatal("Send() returned no error for a 503")
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	status, err := New(50*time.Millisecond).Send(context.Background(), Delivery{URL: ts.URL, Secret: "s"})
+	if err == nil {
+		t.Fatal("Send() returned no error for a receiver that timed out")
+	}
+	if status != 0 {
+		t.Errorf("status = %d, want 0", status)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
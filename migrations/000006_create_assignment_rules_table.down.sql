@@ -0,0 +1,5 @@
+-- Filename: migrations/000006_create_assignment_rules_table.down.sql
+
+DELETE FROM permissions WHERE code = 'admin:access';
+DROP TABLE IF EXISTS assignment_rules;
+ALTER TABLE tblusers DROP COLUMN IF EXISTS available;
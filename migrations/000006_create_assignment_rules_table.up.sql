@@ -0,0 +1,21 @@
+-- Filename: migrations/000006_create_assignment_rules_table.up.sql
+
+-- users can be taken out of the assignment pool without being deactivated
+ALTER TABLE tblusers ADD COLUMN IF NOT EXISTS available bool NOT NULL DEFAULT true;
+
+-- an empty category means the rule applies to every category in the department
+CREATE TABLE IF NOT EXISTS assignment_rules (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    department text NOT NULL,
+    category text NOT NULL DEFAULT '',
+    strategy text NOT NULL,
+    user_ids bigint[] NOT NULL,
+    last_assigned_id bigint NOT NULL DEFAULT 0,
+    version int NOT NULL DEFAULT 1,
+    UNIQUE (department, category)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('admin:access');
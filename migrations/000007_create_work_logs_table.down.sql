@@ -0,0 +1,3 @@
+-- Filename: migrations/000007_create_work_logs_table.down.sql
+
+DROP TABLE IF EXISTS work_logs;
@@ -0,0 +1,16 @@
+-- Filename: migrations/000007_create_work_logs_table.up.sql
+
+CREATE TABLE IF NOT EXISTS work_logs (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    started_on timestamp(0) with time zone NOT NULL,
+    duration_minutes integer NOT NULL CHECK (duration_minutes > 0),
+    note text NOT NULL DEFAULT '',
+    billable bool NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS work_logs_coltech_id_idx ON work_logs (coltech_id);
+CREATE INDEX IF NOT EXISTS work_logs_started_on_idx ON work_logs (started_on);
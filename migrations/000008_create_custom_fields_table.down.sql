@@ -0,0 +1,5 @@
+-- Filename: migrations/000008_create_custom_fields_table.down.sql
+
+DROP INDEX IF EXISTS tblcoltech_custom_fields_idx;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS custom_fields;
+DROP TABLE IF EXISTS custom_fields;
@@ -0,0 +1,18 @@
+-- Filename: migrations/000008_create_custom_fields_table.up.sql
+
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    category text NOT NULL,
+    name text NOT NULL,
+    label text NOT NULL DEFAULT '',
+    type text NOT NULL,
+    options text[] NOT NULL DEFAULT '{}',
+    required bool NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (category, name)
+);
+
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS custom_fields jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS tblcoltech_custom_fields_idx ON tblcoltech USING GIN(custom_fields);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000009_create_ticket_templates_table.down.sql
+
+DROP TABLE IF EXISTS ticket_templates;
+DROP INDEX IF EXISTS tblcoltech_tags_idx;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,19 @@
+-- Filename: migrations/000009_create_ticket_templates_table.up.sql
+
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS tblcoltech_tags_idx ON tblcoltech USING GIN(tags);
+
+CREATE TABLE IF NOT EXISTS ticket_templates (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text UNIQUE NOT NULL,
+    summary text NOT NULL DEFAULT '',
+    description text NOT NULL DEFAULT '',
+    category text NOT NULL DEFAULT '',
+    department text NOT NULL DEFAULT '',
+    priority_val text NOT NULL DEFAULT '',
+    tags text[] NOT NULL DEFAULT '{}',
+    custom_fields jsonb NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
@@ -0,0 +1,4 @@
+-- Filename: migrations/000010_create_recurrences_table.down.sql
+
+DROP TABLE IF EXISTS recurrence_runs;
+DROP TABLE IF EXISTS recurrences;
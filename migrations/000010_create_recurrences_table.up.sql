@@ -0,0 +1,26 @@
+-- Filename: migrations/000010_create_recurrences_table.up.sql
+
+CREATE TABLE IF NOT EXISTS recurrences (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    schedule text NOT NULL,
+    template_id bigint NOT NULL REFERENCES ticket_templates (id) ON DELETE CASCADE,
+    assigned_to text NOT NULL DEFAULT '',
+    created_by text NOT NULL,
+    enabled bool NOT NULL DEFAULT true,
+    next_run timestamp(0) with time zone NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS recurrences_next_run_idx ON recurrences (next_run) WHERE enabled;
+
+-- one row per occurrence; the primary key is what stops two API instances
+-- from both creating a ticket for the same occurrence
+CREATE TABLE IF NOT EXISTS recurrence_runs (
+    recurrence_id bigint NOT NULL REFERENCES recurrences (id) ON DELETE CASCADE,
+    occurrence timestamp(0) with time zone NOT NULL,
+    coltech_id bigint REFERENCES tblcoltech (id) ON DELETE SET NULL,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (recurrence_id, occurrence)
+);
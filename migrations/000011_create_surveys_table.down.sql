@@ -0,0 +1,4 @@
+-- Filename: migrations/000011_create_surveys_table.down.sql
+
+DROP TABLE IF EXISTS surveys;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS requester_id;
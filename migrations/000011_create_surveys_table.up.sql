@@ -0,0 +1,21 @@
+-- Filename: migrations/000011_create_surveys_table.up.sql
+
+-- the user who raised the coltech item, created_by is free text
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS requester_id bigint REFERENCES tblusers (id) ON DELETE SET NULL;
+
+-- assigned_to and department are copied from the coltech item when it is
+-- closed so that later reassignments don't move the rating
+CREATE TABLE IF NOT EXISTS surveys (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    token_hash bytea UNIQUE NOT NULL,
+    assigned_to text NOT NULL,
+    department text NOT NULL,
+    rating integer CHECK (rating BETWEEN 1 AND 5),
+    comment text NOT NULL DEFAULT '',
+    responded_on timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS surveys_created_on_idx ON surveys (created_on);
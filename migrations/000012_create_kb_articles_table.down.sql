@@ -0,0 +1,5 @@
+-- Filename: migrations/000012_create_kb_articles_table.down.sql
+
+DELETE FROM permissions WHERE code IN ('kb:read', 'kb:write');
+DROP TABLE IF EXISTS kb_article_links;
+DROP TABLE IF EXISTS kb_articles;
@@ -0,0 +1,33 @@
+-- Filename: migrations/000012_create_kb_articles_table.up.sql
+
+CREATE TABLE IF NOT EXISTS kb_articles (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    body text NOT NULL,
+    category text NOT NULL,
+    status text NOT NULL DEFAULT 'draft',
+    created_by text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+-- the title is weighted above the body when ranking search results
+CREATE INDEX IF NOT EXISTS kb_articles_search_idx ON kb_articles USING GIN (
+    (setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', body), 'B'))
+);
+CREATE INDEX IF NOT EXISTS kb_articles_category_idx ON kb_articles (category);
+
+CREATE TABLE IF NOT EXISTS kb_article_links (
+    article_id bigint NOT NULL REFERENCES kb_articles (id) ON DELETE CASCADE,
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (article_id, coltech_id)
+);
+
+CREATE INDEX IF NOT EXISTS kb_article_links_coltech_idx ON kb_article_links (coltech_id);
+
+INSERT INTO permissions (code)
+VALUES
+    ('kb:read'),
+    ('kb:write');
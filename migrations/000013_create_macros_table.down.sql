@@ -0,0 +1,5 @@
+-- Filename: migrations/000013_create_macros_table.down.sql
+
+DROP TABLE IF EXISTS macros;
+DROP TABLE IF EXISTS ticket_history;
+DROP TABLE IF EXISTS comments;
@@ -0,0 +1,45 @@
+-- Filename: migrations/000013_create_macros_table.up.sql
+
+CREATE TABLE IF NOT EXISTS comments (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    user_id bigint REFERENCES tblusers (id) ON DELETE SET NULL,
+    body text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS comments_coltech_id_idx ON comments (coltech_id);
+
+-- one row per changed field, source says what made the change (e.g. a macro)
+CREATE TABLE IF NOT EXISTS ticket_history (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    user_id bigint REFERENCES tblusers (id) ON DELETE SET NULL,
+    field text NOT NULL,
+    old_value text NOT NULL,
+    new_value text NOT NULL,
+    source text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS ticket_history_coltech_id_idx ON ticket_history (coltech_id);
+
+-- an empty field value means the macro leaves that field alone
+CREATE TABLE IF NOT EXISTS macros (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    owner_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    shared bool NOT NULL DEFAULT false,
+    status_val text NOT NULL DEFAULT '',
+    priority_val text NOT NULL DEFAULT '',
+    assigned_to text NOT NULL DEFAULT '',
+    category text NOT NULL DEFAULT '',
+    department text NOT NULL DEFAULT '',
+    add_tags text[] NOT NULL DEFAULT '{}',
+    remove_tags text[] NOT NULL DEFAULT '{}',
+    comment text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (owner_id, name)
+);
@@ -0,0 +1,3 @@
+-- Filename: migrations/000014_create_ticket_events_table.down.sql
+
+DROP TABLE IF EXISTS ticket_events;
@@ -0,0 +1,14 @@
+-- Filename: migrations/000014_create_ticket_events_table.up.sql
+
+-- coltech_id has no foreign key so that deleted events outlive the coltech item,
+-- payload holds a snapshot of the coltech item (and comment) at the time
+CREATE TABLE IF NOT EXISTS ticket_events (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    type text NOT NULL,
+    coltech_id bigint NOT NULL,
+    user_id bigint,
+    payload jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ticket_events_created_on_idx ON ticket_events (created_on);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000015_create_webhooks_table.down.sql
+
+DROP TABLE IF EXISTS webhook_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,3 @@
+-- Filename: migrations/000016_create_idempotency_keys_table.down.sql
+
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,17 @@
+-- Filename: migrations/000016_create_idempotency_keys_table.up.sql
+
+-- A status_code of 0 means the first request with the key is still running,
+-- the stored response is replayed to retries once it has finished
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    key text NOT NULL,
+    fingerprint text NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    headers jsonb NOT NULL DEFAULT '{}',
+    body bytea,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_on timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_on_idx ON idempotency_keys (expires_on);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000017_create_due_reminders_table.down.sql
+
+DROP INDEX IF EXISTS tblcoltech_due_on_idx;
+DROP TABLE IF EXISTS due_reminders;
+DROP TABLE IF EXISTS notification_preferences;
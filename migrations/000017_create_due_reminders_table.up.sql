@@ -0,0 +1,21 @@
+-- Filename: migrations/000017_create_due_reminders_table.up.sql
+
+-- a missing row means the user gets that kind of notification
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    kind text NOT NULL,
+    enabled boolean NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+-- one row per reminder sent, keyed on the due date so that moving the due
+-- date sends a fresh set of reminders
+CREATE TABLE IF NOT EXISTS due_reminders (
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    kind text NOT NULL,
+    due_on timestamp(0) with time zone NOT NULL,
+    sent_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (coltech_id, kind, due_on)
+);
+
+CREATE INDEX IF NOT EXISTS tblcoltech_due_on_idx ON tblcoltech (due_on) WHERE status_val <> 'CLOSED';
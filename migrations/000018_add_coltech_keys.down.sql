@@ -0,0 +1,6 @@
+-- Filename: migrations/000018_add_coltech_keys.down.sql
+
+DROP INDEX IF EXISTS tblcoltech_key_idx;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS key;
+DROP TABLE IF EXISTS coltech_keys;
+DROP TABLE IF EXISTS department_sequences;
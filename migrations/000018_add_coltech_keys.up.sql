@@ -0,0 +1,55 @@
+-- Filename: migrations/000018_add_coltech_keys.up.sql
+
+-- each department numbers its coltech items separately under its own prefix
+CREATE TABLE IF NOT EXISTS department_sequences (
+    department text PRIMARY KEY,
+    prefix text UNIQUE NOT NULL,
+    last_number integer NOT NULL DEFAULT 0
+);
+
+-- every key a coltech item has had, so that keys handed out before a move
+-- to another department keep working
+CREATE TABLE IF NOT EXISTS coltech_keys (
+    key text PRIMARY KEY,
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS coltech_keys_coltech_id_idx ON coltech_keys (coltech_id);
+
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS key text;
+
+-- number the existing coltech items in id order, departments whose prefixes
+-- clash get a digit added
+WITH departments AS (
+    SELECT department,
+    COALESCE(NULLIF(upper(left(regexp_replace(department, '[^A-Za-z]', '', 'g'), 3)), ''), 'TKT') AS base,
+    COUNT(*) AS total
+    FROM tblcoltech
+    GROUP BY department
+), ranked AS (
+    SELECT department, base, total, row_number() OVER (PARTITION BY base ORDER BY department) AS rank
+    FROM departments
+)
+INSERT INTO department_sequences (department, prefix, last_number)
+SELECT department, CASE WHEN rank = 1 THEN base ELSE base || rank END, total
+FROM ranked
+ON CONFLICT (department) DO NOTHING;
+
+UPDATE tblcoltech
+SET key = department_sequences.prefix || '-' || lpad(numbered.number::text, GREATEST(4, length(numbered.number::text)), '0')
+FROM (
+    SELECT id, department, row_number() OVER (PARTITION BY department ORDER BY id) AS number
+    FROM tblcoltech
+) numbered
+INNER JOIN department_sequences
+ON department_sequences.department = numbered.department
+WHERE tblcoltech.id = numbered.id
+AND tblcoltech.key IS NULL;
+
+INSERT INTO coltech_keys (key, coltech_id)
+SELECT key, id FROM tblcoltech
+ON CONFLICT (key) DO NOTHING;
+
+ALTER TABLE tblcoltech ALTER COLUMN key SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS tblcoltech_key_idx ON tblcoltech (key);
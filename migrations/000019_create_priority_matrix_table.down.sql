@@ -0,0 +1,8 @@
+-- Filename: migrations/000019_create_priority_matrix_table.down.sql
+
+DELETE FROM permissions WHERE code = 'coltech_items:triage';
+ALTER TABLE ticket_history DROP COLUMN IF EXISTS reason;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS priority_reason;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS urgency;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS impact;
+DROP TABLE IF EXISTS priority_matrix;
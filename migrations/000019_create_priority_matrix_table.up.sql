@@ -0,0 +1,43 @@
+-- Filename: migrations/000019_create_priority_matrix_table.up.sql
+
+-- the priority given to each combination of impact and urgency
+CREATE TABLE IF NOT EXISTS priority_matrix (
+    impact text NOT NULL,
+    urgency text NOT NULL,
+    priority_val text NOT NULL,
+    PRIMARY KEY (impact, urgency)
+);
+
+INSERT INTO priority_matrix (impact, urgency, priority_val)
+VALUES
+    ('HIGH', 'HIGH', 'CRITICAL'),
+    ('HIGH', 'MEDIUM', 'HIGH'),
+    ('HIGH', 'LOW', 'MEDIUM'),
+    ('MEDIUM', 'HIGH', 'HIGH'),
+    ('MEDIUM', 'MEDIUM', 'MEDIUM'),
+    ('MEDIUM', 'LOW', 'LOW'),
+    ('LOW', 'HIGH', 'MEDIUM'),
+    ('LOW', 'MEDIUM', 'LOW'),
+    ('LOW', 'LOW', 'LOW')
+ON CONFLICT DO NOTHING;
+
+-- an empty priority_reason means the priority comes from the matrix
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS impact text NOT NULL DEFAULT 'MEDIUM';
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS urgency text NOT NULL DEFAULT 'MEDIUM';
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS priority_reason text NOT NULL DEFAULT '';
+
+ALTER TABLE ticket_history ADD COLUMN IF NOT EXISTS reason text NOT NULL DEFAULT '';
+
+-- agents may override the priority the matrix gives, admins are agents
+INSERT INTO permissions (code)
+VALUES
+    ('coltech_items:triage');
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, triage.id
+FROM users_permissions
+INNER JOIN permissions
+ON permissions.id = users_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'coltech_items:triage') triage
+WHERE permissions.code = 'admin:access'
+ON CONFLICT DO NOTHING;
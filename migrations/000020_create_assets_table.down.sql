@@ -0,0 +1,5 @@
+-- Filename: migrations/000020_create_assets_table.down.sql
+
+DELETE FROM permissions WHERE code IN ('assets:read', 'assets:write');
+DROP TABLE IF EXISTS asset_links;
+DROP TABLE IF EXISTS assets;
@@ -0,0 +1,35 @@
+-- Filename: migrations/000020_create_assets_table.up.sql
+
+CREATE TABLE IF NOT EXISTS assets (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    asset_tag text NOT NULL,
+    type text NOT NULL,
+    model text NOT NULL DEFAULT '',
+    serial text NOT NULL DEFAULT '',
+    location text NOT NULL DEFAULT '',
+    owner_id bigint REFERENCES tblusers (id) ON DELETE SET NULL,
+    status text NOT NULL DEFAULT 'in_use',
+    warranty_end timestamp(0) with time zone NOT NULL DEFAULT '0001-01-01 00:00:00',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- asset tags are written on labels by hand, so case is not significant
+CREATE UNIQUE INDEX IF NOT EXISTS assets_asset_tag_idx ON assets (upper(asset_tag));
+CREATE INDEX IF NOT EXISTS assets_type_idx ON assets (type);
+CREATE INDEX IF NOT EXISTS assets_owner_id_idx ON assets (owner_id);
+
+CREATE TABLE IF NOT EXISTS asset_links (
+    asset_id bigint NOT NULL REFERENCES assets (id) ON DELETE CASCADE,
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (asset_id, coltech_id)
+);
+
+CREATE INDEX IF NOT EXISTS asset_links_coltech_idx ON asset_links (coltech_id);
+
+INSERT INTO permissions (code)
+VALUES
+    ('assets:read'),
+    ('assets:write');
@@ -0,0 +1,5 @@
+-- Filename: migrations/000021_create_approvals_table.down.sql
+
+DELETE FROM tokens WHERE scope = 'approval';
+DROP TABLE IF EXISTS approvals;
+DROP TABLE IF EXISTS approval_steps;
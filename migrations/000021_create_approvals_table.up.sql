@@ -0,0 +1,28 @@
+-- Filename: migrations/000021_create_approvals_table.up.sql
+
+-- every step for a category must be approved before work on its coltech
+-- items can start
+CREATE TABLE IF NOT EXISTS approval_steps (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    category text NOT NULL,
+    name text NOT NULL,
+    approver_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    UNIQUE (category, name)
+);
+
+-- the step's name and approver are copied when the coltech item is created
+-- so that changing the steps does not change decisions already asked for
+CREATE TABLE IF NOT EXISTS approvals (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    name text NOT NULL,
+    approver_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    token_hash bytea UNIQUE NOT NULL,
+    decision text NOT NULL DEFAULT 'pending',
+    comment text NOT NULL DEFAULT '',
+    decided_on timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS approvals_coltech_id_idx ON approvals (coltech_id);
@@ -0,0 +1,4 @@
+-- Filename: migrations/000022_add_coltech_trigram_indexes.down.sql
+
+DROP INDEX IF EXISTS tblcoltech_description_trgm_idx;
+DROP INDEX IF EXISTS tblcoltech_summary_trgm_idx;
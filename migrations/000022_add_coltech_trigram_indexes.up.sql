@@ -0,0 +1,7 @@
+-- Filename: migrations/000022_add_coltech_trigram_indexes.up.sql
+
+-- trigram similarity is used to find coltech items that look like a new one
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS tblcoltech_summary_trgm_idx ON tblcoltech USING GIN (summary gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS tblcoltech_description_trgm_idx ON tblcoltech USING GIN (description gin_trgm_ops);
@@ -0,0 +1,5 @@
+-- Filename: migrations/000023_create_mentions_tables.down.sql
+
+DELETE FROM notification_preferences WHERE kind = 'mention';
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS watchers;
@@ -0,0 +1,25 @@
+-- Filename: migrations/000023_create_mentions_tables.up.sql
+
+-- users who follow a coltech item, mentioning someone makes them a watcher
+CREATE TABLE IF NOT EXISTS watchers (
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (coltech_id, user_id)
+);
+
+-- the in-app notifications a user sees, read_on stays NULL until they
+-- mark it read
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    coltech_id bigint NOT NULL REFERENCES tblcoltech (id) ON DELETE CASCADE,
+    actor_id bigint REFERENCES tblusers (id) ON DELETE SET NULL,
+    kind text NOT NULL,
+    message text NOT NULL,
+    read_on timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_on DESC);
+CREATE INDEX IF NOT EXISTS watchers_user_id_idx ON watchers (user_id);
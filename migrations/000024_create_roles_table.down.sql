@@ -0,0 +1,7 @@
+-- Filename: migrations/000024_create_roles_table.down.sql
+
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
+DELETE FROM permissions WHERE code = 'reports:read';
+DROP INDEX IF EXISTS permissions_code_idx;
@@ -0,0 +1,59 @@
+-- Filename: migrations/000024_create_roles_table.up.sql
+
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+INSERT INTO permissions (code)
+VALUES
+    ('reports:read')
+ON CONFLICT DO NOTHING;
+
+-- everyone who could see the reports before keeps seeing them
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, reports.id
+FROM users_permissions
+INNER JOIN permissions
+ON permissions.id = users_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'reports:read') reports
+WHERE permissions.code = 'admin:access'
+ON CONFLICT DO NOTHING;
+
+-- a role bundles permission codes, a user has the permissions of each of
+-- their roles as well as any granted to them directly
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    created_on timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name citext UNIQUE NOT NULL,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name, description)
+VALUES
+    ('requester', 'Raises coltech items and reads the knowledge base'),
+    ('agent', 'Works coltech items, triages them and looks after assets and articles'),
+    ('supervisor', 'An agent who can also see the reports'),
+    ('admin', 'Has every permission')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions
+ON (roles.name = 'requester' AND permissions.code IN ('coltech_items:read', 'coltech_items:write', 'kb:read'))
+OR (roles.name = 'agent' AND permissions.code IN ('coltech_items:read', 'coltech_items:write', 'coltech_items:triage',
+    'kb:read', 'kb:write', 'assets:read', 'assets:write'))
+OR (roles.name = 'supervisor' AND permissions.code IN ('coltech_items:read', 'coltech_items:write', 'coltech_items:triage',
+    'kb:read', 'kb:write', 'assets:read', 'assets:write', 'reports:read'))
+OR roles.name = 'admin'
+ON CONFLICT DO NOTHING;
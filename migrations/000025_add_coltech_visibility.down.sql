@@ -0,0 +1,7 @@
+-- Filename: migrations/000025_add_coltech_visibility.down.sql
+
+DELETE FROM permissions WHERE code IN ('coltech_items:read_all', 'coltech_items:read_department');
+DROP TABLE IF EXISTS users_departments;
+DROP INDEX IF EXISTS tblcoltech_requester_id_idx;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS confidential_to;
+ALTER TABLE tblcoltech DROP COLUMN IF EXISTS confidential;
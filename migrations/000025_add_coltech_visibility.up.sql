@@ -0,0 +1,40 @@
+-- Filename: migrations/000025_add_coltech_visibility.up.sql
+
+-- a confidential coltech item can only be seen by its requester, its
+-- assignee and the users named in confidential_to
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS confidential boolean NOT NULL DEFAULT false;
+ALTER TABLE tblcoltech ADD COLUMN IF NOT EXISTS confidential_to bigint[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS tblcoltech_requester_id_idx ON tblcoltech (requester_id);
+
+-- the departments whose coltech items an agent works
+CREATE TABLE IF NOT EXISTS users_departments (
+    user_id bigint NOT NULL REFERENCES tblusers (id) ON DELETE CASCADE,
+    department text NOT NULL,
+    PRIMARY KEY (user_id, department)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('coltech_items:read_all'),
+    ('coltech_items:read_department')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions
+ON (roles.name = 'agent' AND permissions.code = 'coltech_items:read_department')
+OR (roles.name IN ('supervisor', 'admin') AND permissions.code = 'coltech_items:read_all')
+ON CONFLICT DO NOTHING;
+
+-- users given write or admin access by hand before there were roles are
+-- staff, they keep seeing every coltech item
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT DISTINCT users_permissions.user_id, read_all.id
+FROM users_permissions
+INNER JOIN permissions
+ON permissions.id = users_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'coltech_items:read_all') read_all
+WHERE permissions.code IN ('coltech_items:write', 'admin:access')
+ON CONFLICT DO NOTHING;
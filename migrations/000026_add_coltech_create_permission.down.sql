@@ -0,0 +1,11 @@
+-- Filename: migrations/000026_add_coltech_create_permission.down.sql
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions
+ON permissions.code = 'coltech_items:write'
+WHERE roles.name = 'requester'
+ON CONFLICT DO NOTHING;
+
+DELETE FROM permissions WHERE code = 'coltech_items:create';
@@ -0,0 +1,33 @@
+-- Filename: migrations/000026_add_coltech_create_permission.up.sql
+
+-- coltech_items:create lets a user raise coltech items and comment on the
+-- ones they can see without being able to change or delete them, which is
+-- all a requester needs
+INSERT INTO permissions (code)
+VALUES ('coltech_items:create')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions
+ON permissions.code = 'coltech_items:create'
+WHERE roles.name IN ('requester', 'agent', 'supervisor', 'admin')
+ON CONFLICT DO NOTHING;
+
+DELETE FROM roles_permissions
+USING roles, permissions
+WHERE roles_permissions.role_id = roles.id
+AND roles_permissions.permission_id = permissions.id
+AND roles.name = 'requester'
+AND permissions.code = 'coltech_items:write';
+
+-- users given write access by hand can still create
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, create_permission.id
+FROM users_permissions
+INNER JOIN permissions
+ON permissions.id = users_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'coltech_items:create') create_permission
+WHERE permissions.code = 'coltech_items:write'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+-- Filename: migrations/000027_backfill_coltech_requesters.down.sql
+
+-- This down migration deliberately does nothing. The requesters filled in by
+-- the up migration cannot be told apart from ones recorded when the coltech
+-- item was raised, and clearing them would hide coltech items from the
+-- people who raised them.
+SELECT 1;
@@ -0,0 +1,10 @@
+-- Filename: migrations/000027_backfill_coltech_requesters.up.sql
+
+-- coltech items raised before requester_id was recorded only have the
+-- created_by text. Where it is a user's email that user is taken to be the
+-- requester, so that they still see the coltech items they raised.
+UPDATE tblcoltech
+SET requester_id = tblusers.id
+FROM tblusers
+WHERE tblcoltech.requester_id IS NULL
+AND tblusers.email = tblcoltech.created_by::citext;